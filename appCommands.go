@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/manifoldco/promptui"
+)
+
+const APP_USAGE = "usage: hyp app list|remove|rename [-project path] ..."
+
+// runAppCommand manages the apps of a multi-hyp project.
+func runAppCommand(args []string) error {
+	if len(args) < 1 {
+		return errors.New(APP_USAGE)
+	}
+
+	switch args[0] {
+	case "list":
+		return runAppList(args[1:])
+	case "remove":
+		return runAppRemove(args[1:])
+	case "rename":
+		return runAppRename(args[1:])
+	}
+	return errors.New(APP_USAGE)
+}
+
+// openMHAProject loads the project an app command works on, which has to be a
+// multi-hyp one.
+func openMHAProject(projectPath string) (*Project, *[]Config, error) {
+	project, err := openProject(projectPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !project.MHA {
+		return nil, nil, configError(project.ConfigPath, fmt.Errorf("not a multi-hyp project"))
+	}
+
+	configs, err := LoadConfigMHA(project.ConfigPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return project, configs, nil
+}
+
+func findApp(project *Project, configs []Config, name string) (int, error) {
+	i := slices.IndexFunc(configs, func(c Config) bool { return c.Data.Name == name })
+	if i < 0 {
+		return -1, configError(project.ConfigPath, fmt.Errorf("no app named %q", name))
+	}
+	return i, nil
+}
+
+func runAppList(args []string) error {
+	fs := flag.NewFlagSet("app list", flag.ExitOnError)
+	projectPath := projectFlag(fs)
+	fs.Parse(args)
+
+	project, configs, err := openMHAProject(*projectPath)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tID\tVERSION\tPATH")
+	for _, c := range *configs {
+		dir := project.AppDir(&c)
+		path, err := filepath.Rel(project.Dir, dir)
+		if err != nil {
+			path = dir
+		}
+		if _, err := os.Stat(dir); err != nil {
+			path += " (missing)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", c.Data.Name, c.Data.ID, c.AppVersion, path)
+	}
+	return w.Flush()
+}
+
+func runAppRemove(args []string) error {
+	fs := flag.NewFlagSet("app remove", flag.ExitOnError)
+	projectPath := projectFlag(fs)
+	deleteDir := fs.Bool("delete-dir", false, "Also delete the app's directory")
+	yes := fs.Bool("yes", false, "Don't ask before deleting the directory")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return errors.New("usage: hyp app remove [-delete-dir] [-yes] <name>")
+	}
+	name := fs.Arg(0)
+
+	project, configs, err := openMHAProject(*projectPath)
+	if err != nil {
+		return err
+	}
+
+	i, err := findApp(project, *configs, name)
+	if err != nil {
+		return err
+	}
+	dir := project.AppDir(&(*configs)[i])
+
+	if *deleteDir && !*yes {
+		prompt := promptui.Prompt{
+			Label:     fmt.Sprintf("Delete %s and everything in it", dir),
+			IsConfirm: true,
+		}
+		if _, err := prompt.Run(); err != nil {
+			fmt.Println("Nothing removed")
+			return nil
+		}
+	}
+
+	*configs = slices.Delete(*configs, i, i+1)
+	if err := SaveMHAConfig(project.ConfigPath, configs); err != nil {
+		return err
+	}
+	fmt.Printf("Removed %s from %s\n", name, project.ConfigPath)
+
+	if *deleteDir {
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+		fmt.Printf("Deleted %s\n", dir)
+	}
+	return nil
+}
+
+func runAppRename(args []string) error {
+	fs := flag.NewFlagSet("app rename", flag.ExitOnError)
+	projectPath := projectFlag(fs)
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		return errors.New("usage: hyp app rename <old> <new>")
+	}
+	oldName, newName := fs.Arg(0), fs.Arg(1)
+
+	// The name is also the app's directory
+	if newName == "" || newName == "." || newName == ".." || strings.ContainsAny(newName, `/\`) {
+		return &BuildError{Kind: ErrConfig, Err: fmt.Errorf("%q can't be used as an app name", newName)}
+	}
+
+	project, configs, err := openMHAProject(*projectPath)
+	if err != nil {
+		return err
+	}
+
+	i, err := findApp(project, *configs, oldName)
+	if err != nil {
+		return err
+	}
+	if _, err := findApp(project, *configs, newName); err == nil {
+		return configError(project.ConfigPath, fmt.Errorf("there is already an app named %q", newName))
+	}
+
+	config := &(*configs)[i]
+	oldDir := project.AppDir(config)
+	config.Data.Name = newName
+	newDir := project.AppDir(config)
+
+	if _, err := os.Stat(newDir); err == nil {
+		return configError(newDir, fmt.Errorf("already exists"))
+	}
+	if _, err := os.Stat(oldDir); err == nil {
+		if err := os.Rename(oldDir, newDir); err != nil {
+			return err
+		}
+		fmt.Printf("Moved %s to %s\n", oldDir, newDir)
+	}
+
+	if err := SaveMHAConfig(project.ConfigPath, configs); err != nil {
+		// Put the directory back so config and disk still agree
+		os.Rename(newDir, oldDir)
+		return err
+	}
+	fmt.Printf("Renamed %s to %s\n", oldName, newName)
+	return nil
+}
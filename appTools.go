@@ -10,7 +10,7 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"strings"
+	"sync"
 )
 
 // ==================== DATA STRUCTURES ====================
@@ -47,6 +47,8 @@ type AppMetaData struct {
 	AppVersion     string            `json:"app_version,omitempty"`
 	RequiredMods   []string          `json:"required_mods,omitempty"`
 	SourceMap      map[string]string `json:"source_map,omitempty"`
+	Profile        string            `json:"profile,omitempty"` // build profile the app was made with
+	Defines        map[string]string `json:"defines,omitempty"` // values the script was built with
 }
 
 // PropsMap allows both string values and nested objects.
@@ -64,6 +66,7 @@ type Asset struct {
 	URL      string        `json:"url"`
 	Size     int           `json:"size"`
 	Mime     string        `json:"mime"`
+	Source   string        `json:"-"` // The file the asset was read from (not in JSON)
 	FileData []byte        `json:"-"` // The raw embedded bytes (not in JSON)
 	MemFile  *bytes.Reader `json:"-"` // In-memory reader (not in JSON)
 }
@@ -78,28 +81,23 @@ type HypeHeader struct {
 // ==================== EXPORT ====================
 
 // ExportApp takes a Blueprint and returns a single `.hyp` byte slice.
-func ExportApp(bp *Blueprint, existingAssets []Asset) ([]byte, string, error) {
+func ExportApp(out io.Writer, bp *Blueprint, meta *AppMetaData, existingAssets []Asset) ([]byte, error) {
 	// If locked, set frozen
 	if bp.Locked {
 		bp.Frozen = true
 	}
 
-	// Choose a filename
-	filename := "app.hyp"
-	if bp.Name != "" {
-		filename = bp.Name + ".hyp"
-	}
-
 	// Gather assets by extracting correct file data & updating URLs to their SHA-256 hashes
-	fmt.Printf("Size of assets %d\n", len(existingAssets))
+	fmt.Fprintf(out, "Size of assets %d\n", len(existingAssets))
 
 	// Build the JSON header (metadata only)
 	header := HypeHeader{
 		Blueprint: bp,
 		Assets:    make([]Asset, len(existingAssets)),
+		Meta:      meta,
 	}
 	for i, a := range existingAssets {
-		fmt.Printf("Bundling: %s\n", a.URL)
+		fmt.Fprintf(out, "Bundling: %s\n", a.URL)
 		header.Assets[i] = Asset{
 			Type: a.Type,
 			URL:  a.URL,
@@ -108,10 +106,11 @@ func ExportApp(bp *Blueprint, existingAssets []Asset) ([]byte, string, error) {
 		}
 	}
 
-	// 1) Encode header to JSON
+	// 1) Encode header to JSON. Struct fields keep their declared order and
+	// map keys are sorted, so the same header always gives the same bytes.
 	headerBytes, err := json.Marshal(header)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to marshal header: %w", err)
+		return nil, fmt.Errorf("failed to marshal header: %w", err)
 	}
 
 	// 2) Construct the final `.hyp` data
@@ -125,68 +124,27 @@ func ExportApp(bp *Blueprint, existingAssets []Asset) ([]byte, string, error) {
 		finalData = append(finalData, a.FileData...)
 	}
 
-	return finalData, filename, nil
-}
-
-func resolveMime(asset *Asset) string {
-	var mimeType string
-
-	switch asset.Type {
-	case "script":
-		mimeType = "application/javascript"
-	case "avatar":
-		mimeType = "application/octet-stream"
-	case "model":
-		mimeType = "model/gltf-binary"
-	case "emote":
-		mimeType = "model/gltf-binary"
-	case "texture":
-		parts := strings.Split(asset.URL, ".")
-		ext := parts[len(parts)-1]
-		mimeType := "image/" + ext
-		return mimeType
-	default:
-		mimeType := "application/octet-stream"
-		return mimeType
-	}
-
-	asset.Mime = mimeType
-	return mimeType
+	return finalData, nil
 }
 
-func resolvePath(asset *Asset) string {
+// resolveAsset sets the MIME type and the content addressed URL of an asset.
+func resolveAsset(asset *Asset) error {
 	url := "asset://" + hashBytes(asset.FileData)
 
-	switch asset.Type {
-	case "script":
-		url += ".js"
-		break
-	case "avatar":
-		url += ".vrm"
-		break
-	case "model":
-		url += ".glb"
-		break
-	case "emote":
-		url += ".glb"
-		break
-	case "texture":
-		ext := strings.Split(asset.URL, ".")[1]
-		url += "." + ext
-		break
-	case "hdr":
-		url += ".hdr"
-		break
-	case "audio":
-		url += ".mp3"
-		break
-	default:
-		fmt.Printf("Failed to get file extension for type %s\n", asset.Type)
+	if asset.Type == "script" {
+		asset.Mime = "application/javascript"
+		asset.URL = url + ".js"
+		return nil
+	}
 
+	format, err := assetFormat(asset.Type, asset.FileData)
+	if err != nil {
+		return err
 	}
 
-	asset.URL = url
-	return url
+	asset.Mime = format.Mime
+	asset.URL = url + format.Ext
+	return nil
 }
 
 // ==================== HASHING ====================
@@ -222,14 +180,14 @@ func ImportApp(blob []byte) (*Blueprint, []Asset, error) {
 		return nil, nil, errors.New("invalid .hyp data: missing header length")
 	}
 
-	// 1) Read the 4-byte header length
-	headerLen := binary.LittleEndian.Uint32(blob[0:4])
-	if len(blob) < int(4+headerLen) {
+	// 1) Read the 4-byte header length, in uint64 so a huge one can't wrap
+	headerEnd := 4 + uint64(binary.LittleEndian.Uint32(blob[0:4]))
+	if uint64(len(blob)) < headerEnd {
 		return nil, nil, errors.New("invalid .hyp data: truncated header JSON")
 	}
 
 	// 2) Parse the JSON portion
-	headerBytes := blob[4 : 4+headerLen]
+	headerBytes := blob[4:headerEnd]
 	var hdr HypeHeader
 	if err := json.Unmarshal(headerBytes, &hdr); err != nil {
 		return nil, nil, fmt.Errorf("failed to unmarshal header: %w", err)
@@ -240,14 +198,17 @@ func ImportApp(blob []byte) (*Blueprint, []Asset, error) {
 
 	// 3) Extract asset data
 	assets := make([]Asset, len(hdr.Assets))
-	pos := 4 + headerLen
+	pos := int(headerEnd)
 
 	for i, meta := range hdr.Assets {
-		if pos+uint32(meta.Size) > uint32(len(blob)) {
+		if meta.Size < 0 {
+			return nil, nil, fmt.Errorf("invalid .hyp data: asset %s has a negative size", meta.URL)
+		}
+		if meta.Size > len(blob)-pos {
 			return nil, nil, errors.New("invalid .hyp data: not enough bytes for asset data")
 		}
-		dataChunk := blob[pos : pos+uint32(meta.Size)]
-		pos += uint32(meta.Size)
+		dataChunk := blob[pos : pos+meta.Size]
+		pos += meta.Size
 
 		// Create an Asset with in-memory file representation
 		assets[i] = Asset{
@@ -263,24 +224,91 @@ func ImportApp(blob []byte) (*Blueprint, []Asset, error) {
 	return hdr.Blueprint, assets, nil
 }
 
-func AddAssetToGroup(assets *[]Asset, data []byte, fType string) (Asset, error) {
-
-	if assets == nil {
-		return Asset{}, fmt.Errorf("Failed to add data to assets as assets is nil")
-	}
-
+// NewAsset hashes data into an asset of the given type, without adding it anywhere.
+func NewAsset(data []byte, fType string, source string) (Asset, error) {
 	newAsset := Asset{
 		Type:     fType,
 		Size:     len(data),
+		Source:   source,
 		FileData: data,
 		MemFile:  bytes.NewReader(data),
 	}
 
-	resolveMime(&newAsset)
+	if err := resolveAsset(&newAsset); err != nil {
+		return Asset{}, err
+	}
+	return newAsset, nil
+}
+
+// AddAssetToGroup bundles data as an asset of an app. Textures go through the
+// app's texture pipeline first, like texture props do.
+func AddAssetToGroup(opts BuildOptions, config *Config, assets *[]Asset, data []byte, fType string, source string) (Asset, error) {
+
+	if assets == nil {
+		return Asset{}, fmt.Errorf("Failed to add data to assets as assets is nil")
+	}
+
+	if fType == "texture" {
+		var err error
+		data, err = processTexture(opts, config, source, data)
+		if err != nil {
+			return Asset{}, err
+		}
+	}
 
-	resolvePath(&newAsset)
+	newAsset, err := NewAsset(data, fType, source)
+	if err != nil {
+		return Asset{}, err
+	}
 
-	*assets = append(*assets, newAsset)
-	fmt.Printf("Added %s to assets\n", newAsset.URL)
+	if appendAsset(assets, newAsset) {
+		fmt.Fprintf(opts.logger(), "Added %s to assets\n", newAsset.URL)
+	}
 	return newAsset, nil
 }
+
+// appendAsset adds an asset unless one with the same URL is already bundled.
+// The URL is the content hash, so a file used twice is only stored once.
+func appendAsset(assets *[]Asset, asset Asset) bool {
+	for _, a := range *assets {
+		if a.URL == asset.URL {
+			return false
+		}
+	}
+	*assets = append(*assets, asset)
+	return true
+}
+
+// assetCache remembers assets made from shared files, so apps using the same
+// file only read, process and hash it once per build.
+type assetCache struct {
+	mu      sync.Mutex
+	entries map[string]*cachedAsset
+}
+
+type cachedAsset struct {
+	once  sync.Once
+	asset Asset
+	err   error
+}
+
+func newAssetCache() *assetCache {
+	return &assetCache{entries: map[string]*cachedAsset{}}
+}
+
+// get returns the asset stored under key, making it the first time. Apps asking
+// for it at the same time wait for the first one to finish.
+func (c *assetCache) get(key string, makeAsset func() (Asset, error)) (Asset, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &cachedAsset{}
+		c.entries[key] = entry
+	}
+	c.mu.Unlock()
+
+	entry.once.Do(func() {
+		entry.asset, entry.err = makeAsset()
+	})
+	return entry.asset, entry.err
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// hypBlob frames a header the way ExportApp does, followed by data.
+func hypBlob(headerLen uint32, header string, data string) []byte {
+	blob := binary.LittleEndian.AppendUint32(nil, headerLen)
+	return append(append(blob, header...), data...)
+}
+
+func TestImportAppMalformed(t *testing.T) {
+	withSize := func(size string) string {
+		return `{"blueprint":{"name":"x"},"assets":[{"type":"script","url":"asset://a.js","size":` + size + `}]}`
+	}
+
+	cases := map[string][]byte{
+		"short":              {1, 2},
+		"huge header length": hypBlob(0xffffffff, "{}", ""),
+		"negative size":      hypBlob(uint32(len(withSize("-1"))), withSize("-1"), "abc"),
+		"size past the end":  hypBlob(uint32(len(withSize("4"))), withSize("4"), "abc"),
+		"not json":           hypBlob(3, "{{{", ""),
+	}
+	for name, blob := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := ImportApp(blob); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+
+	blob := hypBlob(uint32(len(withSize("3"))), withSize("3"), "abc")
+	_, assets, err := ImportApp(blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(assets) != 1 || string(assets[0].FileData) != "abc" {
+		t.Fatalf("got %+v", assets)
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"text/tabwriter"
+)
+
+// AssetStats are the numbers budgets are checked against.
+type AssetStats struct {
+	Name        string      `json:"name"`
+	Type        string      `json:"type"`
+	Size        int         `json:"size"`
+	Textures    int         `json:"textures"`
+	TextureSize int         `json:"texture_size,omitempty"`
+	Model       *ModelStats `json:"model,omitempty"`
+}
+
+func statAsset(name string, kind string, data []byte) AssetStats {
+	stats := AssetStats{Name: name, Type: kind, Size: len(data)}
+
+	switch kind {
+	case "model", "avatar", "emote":
+		if glb, err := parseGLB(data); err == nil {
+			model := glb.Stats()
+			stats.Model = &model
+			stats.Textures = model.Textures
+			stats.TextureSize = model.TextureSize
+		}
+	case "texture":
+		stats.Textures = 1
+		if w, h, ok := imageSize(data); ok {
+			stats.TextureSize = max(w, h)
+		}
+	}
+
+	return stats
+}
+
+// imageSize reads the dimensions of a texture from its header.
+func imageSize(data []byte) (int, int, bool) {
+	format, _ := detectFormat(data)
+
+	switch format {
+	case formatPNG, formatJPEG:
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return 0, 0, false
+		}
+		return cfg.Width, cfg.Height, true
+	case formatKTX2:
+		if len(data) < 28 {
+			return 0, 0, false
+		}
+		return int(binary.LittleEndian.Uint32(data[20:24])), int(binary.LittleEndian.Uint32(data[24:28])), true
+	case formatWebP:
+		if len(data) < 30 {
+			return 0, 0, false
+		}
+		switch string(data[12:16]) {
+		case "VP8X":
+			w := int(data[24]) | int(data[25])<<8 | int(data[26])<<16
+			h := int(data[27]) | int(data[28])<<8 | int(data[29])<<16
+			return w + 1, h + 1, true
+		case "VP8 ":
+			w := binary.LittleEndian.Uint16(data[26:28]) & 0x3fff
+			h := binary.LittleEndian.Uint16(data[28:30]) & 0x3fff
+			return int(w), int(h), true
+		case "VP8L":
+			bits := binary.LittleEndian.Uint32(data[21:25])
+			return int(bits&0x3fff) + 1, int(bits>>14&0x3fff) + 1, true
+		}
+	}
+
+	return 0, 0, false
+}
+
+// checkBudgets lists every budget the assets go over.
+func checkBudgets(budgets *Budgets, stats []AssetStats, hypSize int) []string {
+	if budgets == nil {
+		return nil
+	}
+
+	var over []string
+	triangles, textures := 0, 0
+
+	for _, s := range stats {
+		if s.Model != nil {
+			triangles += s.Model.Triangles
+		}
+		textures += s.Textures
+
+		if budgets.MaxAssetSize > 0 && s.Size > budgets.MaxAssetSize {
+			over = append(over, fmt.Sprintf("%s is %s, budget is %s per asset", s.Name, formatBytes(s.Size), formatBytes(budgets.MaxAssetSize)))
+		}
+		if budgets.MaxTextureSize > 0 && s.TextureSize > budgets.MaxTextureSize {
+			over = append(over, fmt.Sprintf("%s has a %dpx texture, budget is %dpx", s.Name, s.TextureSize, budgets.MaxTextureSize))
+		}
+	}
+
+	if budgets.MaxTriangles > 0 && triangles > budgets.MaxTriangles {
+		over = append(over, fmt.Sprintf("%d triangles, budget is %d", triangles, budgets.MaxTriangles))
+	}
+	if budgets.MaxTextures > 0 && textures > budgets.MaxTextures {
+		over = append(over, fmt.Sprintf("%d textures, budget is %d", textures, budgets.MaxTextures))
+	}
+	if budgets.MaxHypSize > 0 && hypSize > budgets.MaxHypSize {
+		over = append(over, fmt.Sprintf(".hyp is %s, budget is %s", formatBytes(hypSize), formatBytes(budgets.MaxHypSize)))
+	}
+
+	return over
+}
+
+// enforceBudgets prints the budgets an app goes over, and fails if they're strict.
+func enforceBudgets(opts BuildOptions, config *Config, assets []Asset, hypSize int) error {
+	if config.Budgets == nil {
+		return nil
+	}
+
+	stats := make([]AssetStats, 0, len(assets))
+	for _, a := range assets {
+		stats = append(stats, statAsset(a.Source, a.Type, a.FileData))
+	}
+
+	over := checkBudgets(config.Budgets, stats, hypSize)
+	for _, line := range over {
+		opts.warn("Over budget: %s", line)
+	}
+
+	if len(over) > 0 && config.Budgets.Fail {
+		return fmt.Errorf("%s is over %d budgets", config.Data.Name, len(over))
+	}
+	return nil
+}
+
+// ==================== COMMAND ====================
+
+// projectAssetStats stats the files an app would bundle, without building it.
+func projectAssetStats(config *Config) []AssetStats {
+	var stats []AssetStats
+
+	add := func(path string, kind string) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Printf("Skipping %s: %v\n", path, err)
+			return
+		}
+		if kind == "" {
+			kind, err = inferKind(path, data)
+			if err != nil {
+				fmt.Printf("Skipping %s: %v\n", path, err)
+				return
+			}
+		}
+		stats = append(stats, statAsset(path, kind, data))
+	}
+
+	add(config.ScriptPath, "script")
+	if config.Data.Model != "" {
+		model := "model"
+		if data, err := os.ReadFile(config.Data.Model); err == nil && isVRM(data) {
+			model = "avatar"
+		}
+		add(config.Data.Model, model)
+	}
+
+	if _, err := os.Stat(config.PropsPath); err == nil {
+		props, err := loadProps(config.PropsPath)
+		if err != nil {
+			fmt.Printf("Skipping props: %v\n", err)
+		}
+		for _, prop := range props {
+			initial, ok := prop["initial"].(string)
+			if prop["type"] != "file" || !ok || initial == "" {
+				continue
+			}
+			kind, _ := prop["kind"].(string)
+			add(config.resolvePath(initial), kind)
+		}
+	}
+
+	return stats
+}
+
+func printStats(stats []AssetStats) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ASSET\tTYPE\tSIZE\tTRIANGLES\tTEXTURES\tLARGEST TEXTURE")
+
+	size, triangles, textures := 0, 0, 0
+	for _, s := range stats {
+		tris := "-"
+		if s.Model != nil {
+			tris = fmt.Sprint(s.Model.Triangles)
+			triangles += s.Model.Triangles
+		}
+		texSize := "-"
+		if s.TextureSize > 0 {
+			texSize = fmt.Sprintf("%dpx", s.TextureSize)
+		}
+		size += s.Size
+		textures += s.Textures
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", s.Name, s.Type, formatBytes(s.Size), tris, s.Textures, texSize)
+	}
+
+	fmt.Fprintf(w, "TOTAL\t\t%s\t%d\t%d\t\n", formatBytes(size), triangles, textures)
+	w.Flush()
+}
+
+func runStatsCommand(args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	appName := fs.String("app", "", "Only show this app of a multi-hyp project")
+	hypFile := fs.String("file", "", "Show the numbers for a built .hyp instead of the project")
+	projectPath := projectFlag(fs)
+	fs.Parse(args)
+
+	if *hypFile != "" {
+		blob, err := os.ReadFile(*hypFile)
+		if err != nil {
+			return err
+		}
+
+		blueprint, assets, err := ImportApp(blob)
+		if err != nil {
+			return assetError(*hypFile, err)
+		}
+
+		stats := make([]AssetStats, 0, len(assets))
+		for _, a := range assets {
+			stats = append(stats, statAsset(a.URL, a.Type, a.FileData))
+		}
+
+		fmt.Printf("%s (%s)\n", blueprint.Name, formatBytes(len(blob)))
+		printStats(stats)
+		return nil
+	}
+
+	project, err := openProject(*projectPath)
+	if err != nil {
+		return err
+	}
+
+	configs, err := loadAppConfigs(project, *appName)
+	if err != nil {
+		return err
+	}
+
+	for _, config := range configs {
+		stats := projectAssetStats(config)
+
+		fmt.Printf("\n%s\n", config.Data.Name)
+		printStats(stats)
+
+		// The header is missing until a build, so the .hyp size is checked
+		// against the assets alone.
+		size := 0
+		for _, s := range stats {
+			size += s.Size
+		}
+		for _, line := range checkBudgets(config.Budgets, stats, size) {
+			fmt.Printf("Over budget: %s\n", line)
+		}
+	}
+	return nil
+}
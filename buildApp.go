@@ -2,31 +2,35 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"sync"
+	"time"
 )
 
 type Prop map[string]any
 type Props []Prop
 
-func loadProps(path string) Props {
+func loadProps(path string) (Props, error) {
 	var result Props
 
 	blob, err := os.ReadFile(path)
 	if err != nil {
-		panic(err)
+		return nil, configError(path, err)
 	}
 
 	err = json.Unmarshal(blob, &result)
 	if err != nil {
-		panic(err)
+		return nil, configError(path, jsonError(blob, err))
 	}
 
-	return result
+	return result, nil
 }
 
 func buildBlueprintProps(props Props, header *HypeHeader) {
@@ -43,187 +47,524 @@ func buildBlueprintProps(props Props, header *HypeHeader) {
 	}
 }
 
-func addScript(header *HypeHeader, config *Config) {
-	fmt.Printf("Script were built for %s\n", config.Data.Name)
+func addScript(opts BuildOptions, header *HypeHeader, config *Config) error {
+	out := opts.logger()
+	fmt.Fprintf(out, "Script were built for %s\n", config.Data.Name)
 
-	fmt.Printf("Adding script %s to %s\n", config.ScriptPath, config.Data.Name)
+	fmt.Fprintf(out, "Adding script %s to %s\n", config.ScriptPath, config.Data.Name)
 	scriptBlob, err := os.ReadFile(config.ScriptPath)
 	if err != nil {
-		panic(err)
+		return &BuildError{Kind: ErrScript, Path: config.ScriptPath, Err: err}
+	}
+	if len(config.Defines) > 0 && config.BuildInfo == "" {
+		scriptBlob = substituteDefines(scriptBlob, config.Defines)
 	}
 
-	script_asset, err := AddAssetToGroup(&header.Assets, scriptBlob, "script")
+	script_asset, err := AddAssetToGroup(opts, config, &header.Assets, scriptBlob, "script", config.ScriptPath)
 	if err != nil {
-		panic(err)
+		return assetError(config.ScriptPath, err)
 	}
 
 	header.Blueprint.Script = script_asset.URL
 
-	fmt.Printf("Script added to project %s\n", config.Data.Name)
+	fmt.Fprintf(out, "Script added to project %s\n", config.Data.Name)
+	return nil
 }
 
-func addModel(header *HypeHeader, config *Config) {
-	fmt.Printf("Building Model %s\n", config.Data.Model)
+func addModel(opts BuildOptions, header *HypeHeader, config *Config) error {
+	out := opts.logger()
+	fmt.Fprintf(out, "Building Model %s\n", config.Data.Model)
+
+	model_asset, err := sharedAsset(opts, config, config.Data.Model, "model", func() (Asset, error) {
+		model_blob, err := os.ReadFile(config.Data.Model)
+		if err != nil {
+			return Asset{}, err
+		}
 
-	model_blob, err := os.ReadFile(config.Data.Model)
+		glb, err := parseGLB(model_blob)
+		if err != nil {
+			return Asset{}, fmt.Errorf("invalid model: %w", err)
+		}
+
+		model_type := "model"
+		if glb.IsVRM() {
+			model_type = "avatar"
+		}
+
+		model_blob, glb, err = optimizeModel(opts, config, config.Data.Model, model_blob, glb)
+		if err != nil {
+			return Asset{}, err
+		}
+		fmt.Fprintf(out, "Model %s (%s): %s\n", config.Data.Model, model_type, glb.Stats())
+
+		return NewAsset(model_blob, model_type, config.Data.Model)
+	})
 	if err != nil {
-		panic(err)
+		return assetError(config.Data.Model, err)
 	}
 
-	model_type := "model"
-	if strings.HasSuffix(config.Data.Model, ".vrm") {
-		model_type = "avatar"
+	if appendAsset(&header.Assets, model_asset) {
+		fmt.Fprintf(out, "Added %s to assets\n", model_asset.URL)
+	}
+	header.Blueprint.Model = model_asset.URL
+	return nil
+}
+
+// THUMBNAIL_NAME is what the blueprint image is called, before its extension.
+const THUMBNAIL_NAME = "thumbnail"
+
+// addImage bundles a thumbnail of the configured image as the blueprint image.
+func addImage(opts BuildOptions, header *HypeHeader, config *Config) error {
+	if config.Data.Image == "" {
+		return nil
 	}
 
-	model_asset, err := AddAssetToGroup(&header.Assets, model_blob, model_type)
+	out := opts.logger()
+	fmt.Fprintf(out, "Building thumbnail from %s\n", config.Data.Image)
+
+	image_asset, err := sharedAsset(opts, config, config.Data.Image, "thumbnail", func() (Asset, error) {
+		image_blob, err := os.ReadFile(config.Data.Image)
+		if err != nil {
+			return Asset{}, err
+		}
+
+		thumbnail, err := makeThumbnail(opts, config, config.Data.Image, image_blob)
+		if err != nil {
+			return Asset{}, fmt.Errorf("failed to make thumbnail: %w", err)
+		}
+		return NewAsset(thumbnail, "texture", config.Data.Image)
+	})
 	if err != nil {
-		panic(err)
+		return assetError(config.Data.Image, err)
 	}
-	header.Blueprint.Model = model_asset.URL
+
+	if appendAsset(&header.Assets, image_asset) {
+		fmt.Fprintf(out, "Added %s to assets\n", image_asset.URL)
+	}
+
+	// Not named after its source, a texture prop may bundle that file too
+	header.Blueprint.Image = &ImageData{
+		Type: "texture",
+		Name: THUMBNAIL_NAME + filepath.Ext(image_asset.URL),
+		URL:  image_asset.URL,
+	}
+	return nil
 }
 
-func buildPropFile(header *HypeHeader, prop map[string]any) {
+// sharedAsset makes the asset for a file. Files from the shared directory go
+// through the build's cache, as every app using them would make the same asset.
+func sharedAsset(opts BuildOptions, config *Config, path string, kind string, makeAsset func() (Asset, error)) (Asset, error) {
+	if opts.Assets == nil || !config.isShared(path) {
+		return makeAsset()
+	}
 
-	if _, initialExists := prop["initial"]; !initialExists {
-		fmt.Printf("%s has no \"initial\"\n", prop["key"].(string))
-		// no file to prebuild
-		return
+	// Apps may process the same file differently
+	settings, err := json.Marshal([]any{config.Optimize, config.Textures})
+	if err != nil {
+		return Asset{}, err
 	}
+	return opts.Assets.get(path+"|"+kind+"|"+string(settings), makeAsset)
+}
 
-	if _, kindExists := prop["kind"]; !kindExists {
-		panic(fmt.Errorf("Key \"kind\" was not found on prop for %s", prop["key"].(string)))
+// optimizeModel runs the GLB optimizer over a model when the app turns it on.
+func optimizeModel(opts BuildOptions, config *Config, path string, data []byte, glb *GLB) ([]byte, *GLB, error) {
+	if config.Optimize == nil {
+		return data, glb, nil
 	}
 
-	data := map[string]string{
-		"type": prop["type"].(string),
-		"name": prop["initial"].(string),
-		"url":  "",
+	optimized, report, err := optimizeGLB(data, config.Optimize)
+	if err != nil {
+		opts.warn("Not optimizing %s: %v", path, err)
+		return data, glb, nil
 	}
 
-	fileBlob, err := os.ReadFile(prop["initial"].(string))
+	fmt.Fprintf(opts.logger(), "Optimized %s: %s\n", path, report)
+	glb, err = parseGLB(optimized)
 	if err != nil {
-		panic(err)
+		return nil, nil, fmt.Errorf("optimized model is invalid: %w", err)
+	}
+	return optimized, glb, nil
+}
+
+// buildPropFile reads, checks and hashes the file behind a file prop. It only
+// returns the prop value and asset so it can run on any worker.
+func buildPropFile(opts BuildOptions, config *Config, prop map[string]any) (map[string]string, *Asset, error) {
+	out := opts.logger()
+	key := prop["key"].(string)
+
+	initial, initialExists := prop["initial"].(string)
+	if !initialExists || initial == "" {
+		fmt.Fprintf(out, "%s has no \"initial\"\n", key)
+		// no file to prebuild
+		return nil, nil, nil
 	}
+	initial = config.resolvePath(initial)
 
-	asset, err := AddAssetToGroup(&header.Assets, fileBlob, prop["kind"].(string))
+	kind, _ := prop["kind"].(string)
+	asset, err := sharedAsset(opts, config, initial, kind, func() (Asset, error) {
+		return propAsset(opts, config, key, initial, kind)
+	})
 	if err != nil {
-		panic(err)
+		return nil, nil, propError(key, initial, err)
 	}
 
-	data["url"] = asset.URL
-	header.Blueprint.Props[prop["key"].(string)] = data
+	name := filepath.Base(initial)
+	if asset.Type == "texture" {
+		// The pipeline may have changed the format
+		name = strings.TrimSuffix(name, filepath.Ext(name)) + filepath.Ext(asset.URL)
+	}
+
+	// Same shape Hyperfy stores when a file is dropped on a file field
+	value := map[string]string{
+		"type": asset.Type,
+		"name": name,
+		"url":  asset.URL,
+	}
+	return value, &asset, nil
 }
 
-func validateProp(prop map[string]any) bool {
-	if _, keyExists := prop["key"]; !keyExists {
-		fmt.Println("Required key 'key' is missing!")
-		return false
+// propAsset makes the asset behind a file prop, inferring the kind if the prop
+// has none.
+func propAsset(opts BuildOptions, config *Config, key string, path string, kind string) (Asset, error) {
+	out := opts.logger()
+	fileBlob, err := os.ReadFile(path)
+	if err != nil {
+		return Asset{}, err
+	}
+
+	if kind == "" {
+		kind, err = inferKind(path, fileBlob)
+		if err != nil {
+			return Asset{}, err
+		}
+		opts.warn("Prop %s has no \"kind\", using %s", key, kind)
+	}
+
+	if _, supported := kindFormats[kind]; !supported {
+		return Asset{}, fmt.Errorf("unsupported kind %q", kind)
+	}
+
+	if kind == "model" || kind == "avatar" || kind == "emote" {
+		glb, err := parseGLB(fileBlob)
+		if err != nil {
+			return Asset{}, fmt.Errorf("invalid model: %w", err)
+		}
+		fileBlob, glb, err = optimizeModel(opts, config, path, fileBlob, glb)
+		if err != nil {
+			return Asset{}, err
+		}
+		fmt.Fprintf(out, "Prop %s (%s): %s\n", key, kind, glb.Stats())
+	}
+
+	if kind == "texture" {
+		fileBlob, err = processTexture(opts, config, path, fileBlob)
+		if err != nil {
+			return Asset{}, err
+		}
+	}
+
+	return NewAsset(fileBlob, kind, path)
+}
+
+// validateProp checks the keys every prop needs are there.
+func validateProp(prop map[string]any) error {
+	if _, keyExists := prop["key"].(string); !keyExists {
+		return fmt.Errorf("required key 'key' is missing or not a string")
 	}
 
 	if _, typeExists := prop["type"]; !typeExists {
-		fmt.Println("Required key 'type' is missing!")
-		return false
+		return fmt.Errorf("required key 'type' is missing")
 	}
-	return true
+	return nil
 }
 
-func buildProps(header *HypeHeader, config *Config) {
+// propResult is what a worker made of one prop.
+type propResult struct {
+	key   string
+	value any
+	set   bool
+	asset *Asset
+	err   error
+}
+
+// buildProp builds one prop. It runs on a worker of buildProps, where the
+// recover of buildMHAApp can't reach, so a panic is turned into the prop's error.
+func buildProp(opts BuildOptions, config *Config, prop map[string]any) (result propResult) {
+	result.key, _ = prop["key"].(string)
+	defer func() {
+		if r := recover(); r != nil {
+			result = propResult{key: result.key, err: propError(result.key, config.PropsPath, fmt.Errorf("panic: %v", r))}
+		}
+	}()
+
+	fmt.Fprintf(opts.logger(), "Building %s prop of type %s\n", prop["key"], prop["type"])
+
+	if prop["type"] == "file" {
+		value, asset, err := buildPropFile(opts, config, prop)
+		if value != nil {
+			result.value, result.set = value, true
+		}
+		result.asset, result.err = asset, err
+		return result
+	}
+
+	result.value, result.set = prop["initial"]
+	return result
+}
+
+// buildProps builds every prop on a bounded pool of workers. Files are read and
+// hashed in parallel, then merged into the header in props.json order so the
+// output doesn't depend on scheduling.
+func buildProps(opts BuildOptions, header *HypeHeader, config *Config) error {
 	props_blob, err := os.ReadFile(config.PropsPath)
 	if err != nil {
-		panic(err)
+		return configError(config.PropsPath, err)
 	}
 
 	var data []map[string]any
 	err = json.Unmarshal(props_blob, &data)
 	if err != nil {
-		panic(err)
+		return configError(config.PropsPath, jsonError(props_blob, err))
 	}
 
-	var wg sync.WaitGroup
-	var mutex sync.Mutex
+	var errs []error
+	for i, prop := range data {
+		if err := validateProp(prop); err != nil {
+			errs = append(errs, configError(config.PropsPath, fmt.Errorf("prop %d: %w", i, err)))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	if err := profileProps(config, opts.Profile, data); err != nil {
+		return configError(config.PropsPath, err)
+	}
 
-	for _, prop := range data {
-		prop := prop
-		wg.Add(1)
+	results := make([]propResult, len(data))
+	jobs := make(chan int)
+	out := &lockedWriter{w: opts.logger()} // workers share the app's log
+	opts.Log = out
 
-		go func(prop map[string]any) {
+	var wg sync.WaitGroup
+	for range min(runtime.NumCPU(), len(data)) {
+		wg.Add(1)
+		go func() {
 			defer wg.Done()
-
-			if !validateProp(prop) {
-				panic(fmt.Errorf("Prop does not meet standard see docs"))
+			for i := range jobs {
+				results[i] = buildProp(opts, config, data[i])
 			}
-			fmt.Printf("Building %s prop of type %s\n", prop["key"], prop["type"])
+		}()
+	}
 
-			if prop["type"] == "file" {
-				buildPropFile(header, prop)
-				return
-			}
+	for i := range data {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
 
-			if initial, initialExists := prop["initial"]; initialExists {
-				mutex.Lock()
-				header.Blueprint.Props[prop["key"].(string)] = initial
-				mutex.Unlock()
-			}
-		}(prop)
+	for _, result := range results {
+		if result.err != nil {
+			errs = append(errs, result.err)
+			continue
+		}
+		if result.set {
+			header.Blueprint.Props[result.key] = result.value
+		}
+		if result.asset != nil && appendAsset(&header.Assets, *result.asset) {
+			fmt.Fprintf(out, "Added %s to assets\n", result.asset.URL)
+		}
 	}
 
-	wg.Wait()
+	return errors.Join(errs...)
 }
 
-func buildMHAProject(uniqueDefault bool, buildHypJson bool, noScriptBuild bool) {
-	dir, err := os.Getwd()
-	if err != nil {
-		panic(err)
-	}
+// BuildOptions are the command line switches that apply to every app in a build.
+type BuildOptions struct {
+	UniqueDefault bool
+	HypJson       bool
+	NoScriptBuild bool
+
+	// Reproducible refuses to do anything that would make two builds of the
+	// same sources differ, such as making up an ID that isn't saved.
+	Reproducible bool
+	// CheckReproducible builds every app twice and compares the results
+	// instead of writing them.
+	CheckReproducible bool
+
+	Jobs         int       // apps of a multi-hyp project built at once, 0 for one per CPU
+	FailFast     bool      // stop starting apps once one fails
+	Pack         bool      // also bundle the apps of a multi-hyp project into a .hyppack
+	OutDir       string    // where .hyp files go, overrides out_dir
+	Apps         []string  // names, IDs or globs of the apps to build, all when empty
+	ChangedSince string    // git ref, only apps changed since it are built
+	Profile      string    // profile of each app to build with, none when empty
+	Started      time.Time // {build_time} of defines, now when zero
+	ReportHTML   bool      // also write the build report as HTML
+
+	Warnings *buildWarnings // what the app being built warned about, set by buildApp
+
+	Log    io.Writer   // where build output goes, stdout when nil
+	Assets *assetCache // assets made from shared files, kept for the whole build
+}
 
-	config_path := filepath.Join(dir, APPROLLUP_MHA_NAME)
-	configs := LoadConfigMHA(config_path)
+func (opts BuildOptions) logger() io.Writer {
+	if opts.Log == nil {
+		return os.Stdout
+	}
+	return opts.Log
+}
 
-	var wg sync.WaitGroup
+// buildResult is a bundled app that hasn't been written out yet.
+type buildResult struct {
+	Config   *Config
+	Header   HypeHeader
+	Data     []byte
+	Filename string // where the .hyp goes, see outputPath
+	Report   *BuildReport
+}
 
-	for _, conf := range *configs {
-		conf := conf // Prevent loop variable capture issue
-		wg.Add(1)    // Increment WaitGroup counter
-		go func(c Config) {
-			defer wg.Done() // Mark as done when function exits
-			buildAppProject(uniqueDefault, buildHypJson, noScriptBuild, &c)
-		}(conf)
+// assignID gives an app without an ID a new one, and reports whether the
+// config changed. The caller saves it so the next build gets the same ID.
+func assignID(config *Config, path string, opts BuildOptions) (bool, error) {
+	if config.Data.ID != "" {
+		return false, nil
+	}
+	if opts.Reproducible {
+		return false, configError(path, fmt.Errorf("%s has no id, set data.id or run a normal build once to save one", config.Data.Name))
 	}
 
-	wg.Wait() // Wait for all goroutines to finish before returning
+	config.Data.ID = uuid()
+	fmt.Printf("Saving new id %s for %s to %s\n", config.Data.ID, config.Data.Name, path)
+	return true, nil
 }
 
-func buildAppProject(uniqueDefault bool, buildHypJson bool, noScriptBuild bool, config *Config) {
-	dir, err := os.Getwd()
+// buildAppProject builds one app. With no config it builds a single app
+// project, otherwise the given app of a multi-hyp project.
+func buildAppProject(opts BuildOptions, project *Project, config *Config) (*buildResult, error) {
+	if config == nil {
+		var err error
+		config, err = LoadConfig(project.ConfigPath)
+		if err != nil {
+			return nil, err
+		}
 
+		assigned, err := assignID(config, project.ConfigPath, opts)
+		if err != nil {
+			return nil, err
+		}
+		if assigned {
+			if err := SaveConfig(project.ConfigPath, config); err != nil {
+				return nil, configError(project.ConfigPath, err)
+			}
+		}
+	}
+	if missing := requiredFields(config); len(missing) > 0 {
+		return nil, withApp(config.Data.Name, configError(project.ConfigPath, errors.Join(missing...)))
+	}
+	rebaseConfig(config, project.AppDir(config))
+	config.CacheDir = filepath.Join(project.Dir, CACHE_DIR)
+	if err := applyProfile(config, opts.Profile); err != nil {
+		return nil, withApp(config.Data.Name, configError(project.ConfigPath, err))
+	}
+	if err := resolveDefines(opts, config); err != nil {
+		return nil, withApp(config.Data.Name, configError(project.ConfigPath, err))
+	}
+
+	// Bad output settings fail before the build rather than after it
+	filename, err := outputPath(opts, project, config)
 	if err != nil {
-		panic(err)
+		return nil, withApp(config.Data.Name, err)
 	}
 
-	if config == nil {
-		rollup_config := filepath.Join(dir, APPROLLUP_FILENAME)
-		config = LoadConfig(rollup_config)
+	var result *buildResult
+	if opts.CheckReproducible {
+		result, err = checkReproducible(opts, config)
 	} else {
-		dir = filepath.Join(dir, config.Data.Name)
-		config.Data.Model = filepath.Join(dir, config.Data.Model)
-		config.ScriptPath = filepath.Join(dir, config.ScriptPath)
-		config.AssetsPath = filepath.Join(dir, config.AssetsPath)
-		config.PropsPath = filepath.Join(dir, config.PropsPath)
+		result, err = buildApp(opts, config)
+	}
+	if err != nil {
+		return nil, withApp(config.Data.Name, err)
 	}
-	// props_path := filepath.Join(dir, config.PropsPath)
-	// props := loadProps(props_path)
 
-	fmt.Printf("Building app %s by %s (v%s)\n", config.Data.Name, config.Data.Author, config.AppVersion)
+	result.Filename = filename
+	result.Report.Inputs.Config = project.ConfigPath
+	if opts.CheckReproducible {
+		return result, nil
+	}
+	return result, withApp(config.Data.Name, writeBuild(opts, result))
+}
 
-	var newHeader HypeHeader
+// checkReproducible builds an app twice and fails if the two .hyp files differ.
+func checkReproducible(opts BuildOptions, config *Config) (*buildResult, error) {
+	first, err := buildApp(opts, config)
+	if err != nil {
+		return nil, err
+	}
+	second, err := buildApp(opts, config)
+	if err != nil {
+		return nil, err
+	}
+
+	firstHash, secondHash := hashBytes(first.Data), hashBytes(second.Data)
+	if firstHash == secondHash {
+		fmt.Fprintf(opts.logger(), "%s is reproducible (sha256 %s)\n", config.Data.Name, firstHash)
+		return first, nil
+	}
 
-	id := config.Data.ID
-	if id == "" {
-		id = uuid()
+	// Point at what changed, the hash alone doesn't help much
+	var diffs []string
+	for i := range max(len(first.Header.Assets), len(second.Header.Assets)) {
+		var a, b string
+		if i < len(first.Header.Assets) {
+			a = first.Header.Assets[i].URL
+		}
+		if i < len(second.Header.Assets) {
+			b = second.Header.Assets[i].URL
+		}
+		if a != b {
+			diffs = append(diffs, fmt.Sprintf("asset %d: %s != %s", i, a, b))
+		}
+	}
+	if len(diffs) == 0 {
+		diffs = append(diffs, "the assets match, the header differs")
+	}
+
+	return nil, fmt.Errorf("two builds differ (sha256 %s != %s): %s", firstHash, secondHash, strings.Join(diffs, "; "))
+}
+
+// writeBuild saves a built app, and its header as JSON when asked to.
+func writeBuild(opts BuildOptions, result *buildResult) error {
+	if err := os.MkdirAll(filepath.Dir(result.Filename), 0777); err != nil {
+		return err
+	}
+	if err := keepPreviousBuilds(result.Filename, result.Data, result.Config.KeepBuilds); err != nil {
+		return err
+	}
+	if err := os.WriteFile(result.Filename, result.Data, 0666); err != nil {
+		return err
 	}
 
+	if opts.HypJson {
+		blob, err := json.MarshalIndent(result.Header, "", "    ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(result.Filename+".json", blob, 0666); err != nil {
+			return err
+		}
+	}
+
+	return writeReport(opts, result)
+}
+
+func buildApp(opts BuildOptions, config *Config) (*buildResult, error) {
+	out := opts.logger()
+	fmt.Fprintf(out, "Building app %s by %s (v%s)\n", config.Data.Name, config.Data.Author, config.AppVersion)
+
+	var newHeader HypeHeader
+
 	newHeader.Blueprint = &Blueprint{
-		ID:      id,
+		ID:      config.Data.ID,
 		Name:    config.Data.Name,
 		Author:  config.Data.Author,
 		Version: config.Data.Version,
@@ -234,67 +575,88 @@ func buildAppProject(uniqueDefault bool, buildHypJson bool, noScriptBuild bool,
 		Script: "",
 		Props:  map[string]any{},
 
-		Unique:  config.Data.Unique || uniqueDefault,
+		Unique:  config.Data.Unique || opts.UniqueDefault,
 		Locked:  false,
 		Frozen:  false,
 		Preload: config.Data.Preload,
 		Public:  config.Data.Public,
 	}
 
-	fmt.Printf("Building %s's scripts\n", config.Data.Name)
+	report := newBuildReport(opts, config)
+	opts.Warnings = &buildWarnings{}
 
-	/* Build the scripts */
-	if !noScriptBuild {
-		cmd := exec.Command("npx", "rollup", "-c")
-		cmd.Dir = dir
-		cmd.Stdout = os.Stdout // Pipe output to terminal
-		cmd.Stderr = os.Stderr // Pipe errors to terminal
+	fmt.Fprintf(out, "Building %s's scripts\n", config.Data.Name)
 
-		err = cmd.Run()
+	if config.BuildInfo != "" {
+		if err := writeBuildInfo(config); err != nil {
+			return nil, &BuildError{Kind: ErrScript, Path: config.resolvePath(config.BuildInfo), Err: err}
+		}
+	}
+
+	/* Build the scripts */
+	if !opts.NoScriptBuild {
+		err := report.phase("build command", func() error {
+			command, env := buildCommand(config, opts.Profile)
+			cmd := exec.Command(command[0], command[1:]...)
+			cmd.Dir = config.Dir
+			cmd.Env = env
+			cmd.Stdout = out // Pipe output to the build log
+			cmd.Stderr = out
+
+			if err := cmd.Run(); err != nil {
+				return &BuildError{Kind: ErrScript, Path: config.Dir, Err: fmt.Errorf("%s: %w", strings.Join(command, " "), err)}
+			}
+			return nil
+		})
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
 	}
 
 	// -- ADD SCRIPT TO HYP --
-	addScript(&newHeader, config)
+	if err := report.phase("script", func() error { return addScript(opts, &newHeader, config) }); err != nil {
+		return nil, err
+	}
 
 	// -- ADD MODEL TO HYP --
-	addModel(&newHeader, config)
+	if err := report.phase("model", func() error { return addModel(opts, &newHeader, config) }); err != nil {
+		return nil, err
+	}
+
+	// -- ADD THUMBNAIL TO HYP --
+	if err := report.phase("image", func() error { return addImage(opts, &newHeader, config) }); err != nil {
+		return nil, err
+	}
 
 	// -- ADD PROPS TO HYP --
-	buildProps(&newHeader, config)
+	if err := report.phase("props", func() error { return buildProps(opts, &newHeader, config) }); err != nil {
+		return nil, err
+	}
 
 	// -- DONE BUILDING -- //
 
-	// Bundle the hype
-	fmt.Printf("We have %d assets for %s\n", len(newHeader.Assets), newHeader.Blueprint.Name)
-	hyp_data, filename, err := ExportApp(newHeader.Blueprint, newHeader.Assets)
-	if err != nil {
-		panic(err)
+	if opts.Profile != "" || len(config.Defines) > 0 {
+		newHeader.Meta = &AppMetaData{AppVersion: config.AppVersion, Profile: opts.Profile, Defines: config.Defines}
 	}
 
-	// Save stuff to hyp
-	file, err := os.Create(filename)
+	// Bundle the hype
+	fmt.Fprintf(out, "We have %d assets for %s\n", len(newHeader.Assets), newHeader.Blueprint.Name)
+	var hyp_data []byte
+	err := report.phase("export", func() error {
+		var err error
+		hyp_data, err = ExportApp(out, newHeader.Blueprint, newHeader.Meta, newHeader.Assets)
+		return err
+	})
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	defer file.Close()
 
-	file.Write(hyp_data)
+	if err := enforceBudgets(opts, config, newHeader.Assets, len(hyp_data)); err != nil {
+		return nil, &BuildError{Kind: ErrAsset, Err: err}
+	}
 
-	// build hyp json
-	if buildHypJson {
-		file, err = os.Create(filename + ".json")
-		if err != nil {
-			panic(err)
-		}
-		defer file.Close()
+	report.addAssets(newHeader.Assets)
+	report.Warnings = append(report.Warnings, opts.Warnings.list...)
 
-		blob, err := json.MarshalIndent(newHeader, "", "    ")
-		if err != nil {
-			panic(err)
-		}
-		file.Write(blob)
-	}
+	return &buildResult{Config: config, Header: newHeader, Data: hyp_data, Report: report}, nil
 }
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writePNG writes a small image whose pixels depend on seed, so every seed
+// gives a different asset.
+func writePNG(t *testing.T, path string, seed int) {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for i := range 16 {
+		img.Set(i%4, i/4, color.RGBA{uint8(seed), uint8(seed * 7), uint8(i), 255})
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0666); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// propsFixture makes an app with many file props, where several point at the
+// same app file and several at the same shared file.
+func propsFixture(t *testing.T) *Config {
+	t.Helper()
+	root := t.TempDir()
+	dir := filepath.Join(root, "app")
+	shared := filepath.Join(root, "shared")
+
+	for i := range 8 {
+		writePNG(t, filepath.Join(dir, fmt.Sprintf("tex%d.png", i)), i)
+	}
+	writePNG(t, filepath.Join(shared, "common.png"), 100)
+
+	var props []map[string]any
+	for i := range 40 {
+		initial := fmt.Sprintf("tex%d.png", i%8) // every file used five times
+		if i%5 == 0 {
+			initial = SHARED_PREFIX + "common.png"
+		}
+		props = append(props, map[string]any{
+			"key":     fmt.Sprintf("file%d", i),
+			"type":    "file",
+			"kind":    "texture",
+			"initial": initial,
+		})
+		props = append(props, map[string]any{"key": fmt.Sprintf("n%d", i), "type": "number", "initial": i})
+	}
+
+	blob, err := json.Marshal(props)
+	if err != nil {
+		t.Fatal(err)
+	}
+	propsPath := filepath.Join(dir, "props.json")
+	if err := os.WriteFile(propsPath, blob, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	return &Config{
+		Data:      MetaData{ID: "test", Name: "test"},
+		PropsPath: propsPath,
+		Dir:       dir,
+		SharedDir: shared,
+	}
+}
+
+func buildPropsOnce(t *testing.T, config *Config, opts BuildOptions) ([]string, []byte) {
+	t.Helper()
+	header := HypeHeader{Blueprint: &Blueprint{ID: "test", Name: "test", Props: map[string]any{}}}
+	if err := buildProps(opts, &header, config); err != nil {
+		t.Fatal(err)
+	}
+
+	urls := make([]string, len(header.Assets))
+	for i, a := range header.Assets {
+		urls[i] = a.URL
+	}
+	data, err := ExportApp(io.Discard, header.Blueprint, nil, header.Assets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return urls, data
+}
+
+// TestBuildPropsStable builds the same props many times, with and without the
+// shared asset cache, and expects the same assets in the same order and the
+// same .hyp bytes every time. Run it with -race to check the workers.
+func TestBuildPropsStable(t *testing.T) {
+	config := propsFixture(t)
+	opts := BuildOptions{Log: io.Discard}
+
+	wantURLs, wantData := buildPropsOnce(t, config, opts)
+	if len(wantURLs) != 9 {
+		t.Fatalf("got %d assets, want 9 (8 app files and 1 shared file, each once)", len(wantURLs))
+	}
+
+	opts.Assets = newAssetCache()
+	for run := range 20 {
+		urls, data := buildPropsOnce(t, config, opts)
+		if fmt.Sprint(urls) != fmt.Sprint(wantURLs) {
+			t.Fatalf("run %d: asset order changed:\n got %v\nwant %v", run, urls, wantURLs)
+		}
+		if !bytes.Equal(data, wantData) {
+			t.Fatalf("run %d: .hyp bytes changed", run)
+		}
+	}
+}
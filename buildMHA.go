@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+// appBuild is how one app of a multi-hyp project went.
+type appBuild struct {
+	Name     string
+	Status   string // ok, failed or skipped
+	Err      error
+	Duration time.Duration
+	Size     int
+	Output   string
+	Result   *buildResult
+	Log      bytes.Buffer
+}
+
+// buildMHAProject builds the apps of a multi-hyp project on a bounded pool.
+// Each app logs to its own buffer, printed in one piece once it's done, and a
+// failing app doesn't stop the others unless FailFast is set.
+func buildMHAProject(opts BuildOptions, project *Project) error {
+	config_path := project.ConfigPath
+	configs, err := LoadConfigMHA(config_path)
+	if err != nil {
+		return err
+	}
+
+	// IDs are saved before any app starts building, so apps never race on the file
+	changed := false
+	for i := range *configs {
+		assigned, err := assignID(&(*configs)[i], config_path, opts)
+		if err != nil {
+			return err
+		}
+		changed = changed || assigned
+	}
+	if changed {
+		if err := SaveMHAConfig(config_path, configs); err != nil {
+			return configError(config_path, err)
+		}
+	}
+
+	selected, err := selectApps(*configs, project, opts)
+	if err != nil {
+		return err
+	}
+	if len(selected) == 0 {
+		fmt.Println("No apps to build")
+		return nil
+	}
+	if len(selected) < len(*configs) {
+		// A pack of some apps would replace the project's pack of all of them
+		if opts.Pack {
+			return &BuildError{Kind: ErrConfig, Err: fmt.Errorf("-pack packs every app, but only %d of %d are selected, drop -app and -changed", len(selected), len(*configs))}
+		}
+		fmt.Printf("Building %d of %d apps\n", len(selected), len(*configs))
+	}
+	if err := checkOutputs(opts, project, *configs, selected); err != nil {
+		return err
+	}
+
+	builds := make([]*appBuild, len(selected))
+	for i, app := range selected {
+		builds[i] = &appBuild{Name: (*configs)[app].Data.Name, Status: "skipped"}
+	}
+
+	workers := opts.Jobs
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	// Shared files are made into assets once for all apps
+	opts.Assets = newAssetCache()
+
+	jobs := make(chan int)
+	var failed atomic.Bool
+	var printMutex sync.Mutex
+	var wg sync.WaitGroup
+
+	for range min(workers, len(builds)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if opts.FailFast && failed.Load() {
+					continue
+				}
+				build := builds[i]
+				buildMHAApp(opts, project, (*configs)[selected[i]], build)
+				if build.Err != nil {
+					failed.Store(true)
+				}
+
+				printMutex.Lock()
+				fmt.Printf("==> %s (%s, %s)\n%s\n", build.Name, build.Status, build.Duration.Round(time.Millisecond), build.Log.String())
+				printMutex.Unlock()
+			}
+		}()
+	}
+
+	for i := range builds {
+		if opts.FailFast && failed.Load() {
+			break
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	printBuildSummary(builds)
+
+	var errs []error
+	var results []*buildResult
+	for _, build := range builds {
+		if build.Err != nil {
+			errs = append(errs, build.Err)
+		}
+		if build.Result != nil {
+			results = append(results, build.Result)
+		}
+	}
+
+	if opts.Pack && !opts.CheckReproducible {
+		if len(results) < len(builds) {
+			fmt.Println("Not packing, some apps didn't build")
+		} else {
+			dir := project.Dir
+			if opts.OutDir != "" {
+				dir = opts.OutDir
+			}
+			pack := filepath.Join(dir, filepath.Base(project.Dir)+HYPPACK_EXT)
+			if err := writePack(pack, results); err != nil {
+				errs = append(errs, assetError(pack, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkOutputs fails when two of the selected apps would be written to the
+// same file, as they build at the same time and one would silently win.
+func checkOutputs(opts BuildOptions, project *Project, configs []Config, selected []int) error {
+	if opts.CheckReproducible {
+		return nil
+	}
+
+	owners := map[string]string{}
+	var errs []error
+	for _, i := range selected {
+		// Resolved the way buildAppProject does, the profile may rename the app
+		config := configs[i]
+		rebaseConfig(&config, project.AppDir(&config))
+		if applyProfile(&config, opts.Profile) != nil {
+			continue // the app's build reports it
+		}
+		filename, err := outputPath(opts, project, &config)
+		if err != nil {
+			continue
+		}
+
+		name := configs[i].Data.Name
+		if other, ok := owners[filename]; ok {
+			errs = append(errs, fmt.Errorf("%s and %s would both be written to %s, give them different out_name", other, name, filename))
+			continue
+		}
+		owners[filename] = name
+	}
+	if len(errs) > 0 {
+		return configError(project.ConfigPath, errors.Join(errs...))
+	}
+	return nil
+}
+
+// selectApps returns the indexes of the apps to build. Apps are picked by name
+// or ID, with globs, and with ChangedSince only apps whose directory changed in
+// git since that ref are kept.
+func selectApps(configs []Config, project *Project, opts BuildOptions) ([]int, error) {
+	picked := make([]bool, len(configs))
+	for i := range picked {
+		picked[i] = len(opts.Apps) == 0
+	}
+
+	for _, pattern := range opts.Apps {
+		found := false
+		for i, c := range configs {
+			nameMatch, err := path.Match(pattern, c.Data.Name)
+			if err != nil {
+				return nil, &BuildError{Kind: ErrConfig, Err: fmt.Errorf("bad app pattern %q: %w", pattern, err)}
+			}
+			idMatch, _ := path.Match(pattern, c.Data.ID)
+			if nameMatch || idMatch {
+				picked[i], found = true, true
+			}
+		}
+		if !found {
+			return nil, configError(project.ConfigPath, fmt.Errorf("no app matches %q", pattern))
+		}
+	}
+
+	if opts.ChangedSince != "" {
+		files, err := changedFiles(project.Dir, opts.ChangedSince)
+		if err != nil {
+			return nil, err
+		}
+		for i, c := range configs {
+			if picked[i] && !appChanged(files, &c, project) {
+				picked[i] = false
+			}
+		}
+	}
+
+	var selected []int
+	for i := range picked {
+		if picked[i] {
+			selected = append(selected, i)
+		}
+	}
+	return selected, nil
+}
+
+// appChanged tells if any of files belongs to the app. The project config and
+// shared files may be used by every app. What hyp writes itself doesn't count,
+// or every build would mark its app changed for the next one.
+func appChanged(files []string, config *Config, project *Project) bool {
+	appDir := project.AppDir(config)
+	for _, f := range files {
+		if generatedFile(f, config, appDir) {
+			continue
+		}
+		if f == project.ConfigPath || config.isShared(f) || strings.HasPrefix(f, appDir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// GENERATED_SUFFIXES end the names of the files a build writes: the .hyp and
+// its rotated copies, -bjson dumps, reports and packs.
+var GENERATED_SUFFIXES = []string{".hyp", ".hyp.json", ".report.json", ".report.html", HYPPACK_EXT}
+
+// generatedFile tells if a file is one hyp writes while building, the app's
+// build_info module, an output or anything in a .hypcache.
+func generatedFile(path string, config *Config, appDir string) bool {
+	if config.BuildInfo != "" {
+		buildInfo := config.BuildInfo
+		if !filepath.IsAbs(buildInfo) {
+			buildInfo = filepath.Join(appDir, buildInfo)
+		}
+		if path == buildInfo {
+			return true
+		}
+	}
+
+	for _, suffix := range GENERATED_SUFFIXES {
+		if strings.HasSuffix(path, suffix) {
+			return true
+		}
+	}
+	return slices.Contains(strings.Split(path, string(filepath.Separator)), CACHE_DIR)
+}
+
+// buildMHAApp builds one app into build, turning a panic into a failed build
+// so it can't take the other apps down with it.
+func buildMHAApp(opts BuildOptions, project *Project, config Config, build *appBuild) {
+	opts.Log = &build.Log
+	start := time.Now()
+
+	defer func() {
+		if r := recover(); r != nil {
+			build.Err = withApp(build.Name, fmt.Errorf("panic: %v", r))
+		}
+		build.Duration = time.Since(start)
+		build.Status = "ok"
+		if build.Err != nil {
+			build.Status = "failed"
+		}
+	}()
+
+	result, err := buildAppProject(opts, project, &config)
+	build.Err, build.Result = err, result
+	if result != nil {
+		build.Size = len(result.Data)
+		if !opts.CheckReproducible {
+			build.Output = result.Filename
+		}
+	}
+}
+
+func printBuildSummary(builds []*appBuild) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "APP\tSTATUS\tDURATION\tSIZE\tOUTPUT")
+
+	for _, b := range builds {
+		duration, size, output := "-", "-", "-"
+		if b.Status != "skipped" {
+			duration = b.Duration.Round(time.Millisecond).String()
+		}
+		if b.Size > 0 {
+			size = formatBytes(b.Size)
+		}
+		if b.Output != "" {
+			output = b.Output
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", b.Name, b.Status, duration, size, output)
+	}
+	w.Flush()
+}
@@ -3,7 +3,8 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"os"
+	"path/filepath"
+	"strings"
 )
 
 type MetaData struct {
@@ -14,6 +15,7 @@ type MetaData struct {
 	URL     string `json:"url"`
 	Desc    string `json:"desc"`
 	Model   string `json:"model"`
+	Image   string `json:"image,omitempty"` // shrunk down to the blueprint thumbnail
 
 	Preload bool `json:"preload"`
 	Public  bool `json:"public"`
@@ -21,85 +23,283 @@ type MetaData struct {
 }
 
 type Config struct {
-	Data       MetaData `json:"data"`
-	AppVersion string   `json:"app_version"`
-	ScriptPath string   `json:"script_path"`
-	AssetsPath string   `json:"assets_path"`
-	PropsPath  string   `json:"props_path"`
+	Schema        string   `json:"$schema,omitempty"`        // for editors, see schemas/
+	SchemaVersion int      `json:"schema_version,omitempty"` // see migrate.go, kept at the top of approllup.mha.json
+	Data          MetaData `json:"data"`
+	AppVersion    string   `json:"app_version"`
+	ScriptPath    string   `json:"script_path"`
+	AssetsPath    string   `json:"assets_path"`
+	PropsPath     string   `json:"props_path"`
+
+	Budgets  *Budgets         `json:"budgets,omitempty"`
+	Optimize *OptimizeOptions `json:"optimize,omitempty"`
+	Textures *TextureOptions  `json:"textures,omitempty"`
+
+	OutDir     string `json:"out_dir,omitempty"`     // where builds go, relative to the project config
+	OutName    string `json:"out_name,omitempty"`    // file name template, "{name}.hyp" when unset
+	KeepBuilds int    `json:"keep_builds,omitempty"` // previous builds kept as name.1.hyp, name.2.hyp...
+
+	Profiles map[string]*Profile `json:"profiles,omitempty"` // picked with -profile, see profile.go
+
+	Defines   map[string]string `json:"defines,omitempty"`    // identifiers replaced in the script, values may use {tokens}, see defines.go
+	BuildInfo string            `json:"build_info,omitempty"` // module the defines are written to instead, e.g. src/build-info.js
+
+	Dir       string `json:"-"` // app directory, set by rebaseConfig
+	SharedDir string `json:"-"` // shared assets of a multi-hyp project
+	CacheDir  string `json:"-"` // .hypcache of the project, next to its config
+
+	mhaIndex int // position in approllup.mha.json plus one, 0 for apps not saved yet
+}
+
+// SHARED_PREFIX marks a path in the shared directory of a multi-hyp project.
+const SHARED_PREFIX = "shared:"
+
+// DEFAULT_SHARED_DIR is the shared directory, next to approllup.mha.json,
+// when the project doesn't name one.
+const DEFAULT_SHARED_DIR = "shared"
+
+// TextureOptions controls the image pipeline texture assets go through.
+type TextureOptions struct {
+	MaxSize       int    `json:"max_size,omitempty"`       // longest side in pixels, larger images are shrunk
+	Format        string `json:"format,omitempty"`         // "png" or "jpeg", empty keeps the input format
+	Quality       int    `json:"quality,omitempty"`        // JPEG quality, 85 when unset
+	FlipY         bool   `json:"flip_y,omitempty"`         // flip images upside down
+	ThumbnailSize int    `json:"thumbnail_size,omitempty"` // longest side of the thumbnail, 256 when unset
+}
+
+// OptimizeOptions picks the passes run over GLB models before they are bundled.
+type OptimizeOptions struct {
+	Prune       bool `json:"prune"`        // drop nodes, materials, accessors... nothing uses
+	StripExtras bool `json:"strip_extras"` // drop every "extras" object
+	Dedupe      bool `json:"dedupe"`       // share identical buffer views and images
+}
+
+// Budgets caps how heavy an app may get. A zero value means no limit.
+type Budgets struct {
+	MaxTriangles   int  `json:"max_triangles,omitempty"`    // all models together
+	MaxTextures    int  `json:"max_textures,omitempty"`     // all models and texture props together
+	MaxTextureSize int  `json:"max_texture_size,omitempty"` // width or height in pixels
+	MaxAssetSize   int  `json:"max_asset_size,omitempty"`   // bytes per asset
+	MaxHypSize     int  `json:"max_hyp_size,omitempty"`     // bytes for the whole .hyp
+	Fail           bool `json:"fail,omitempty"`             // fail the build instead of warning
 }
 
-func LoadConfig(path string) *Config {
-	blob, err := os.ReadFile(path)
+// LoadConfig loads the config of a single app, in any of the config formats.
+func LoadConfig(path string) (*Config, error) {
+	blob, err := readConfigFile(path)
 
 	if err != nil {
-		panic(err)
+		return nil, configError(path, err)
+	}
+
+	var raw map[string]any
+	if err := json.Unmarshal(blob, &raw); err != nil {
+		return nil, configError(path, decodeError(path, blob, err))
+	}
+	version, err := schemaVersionOf(raw)
+	if err == nil {
+		err = checkSchemaVersion(version)
+	}
+	if err != nil {
+		return nil, configError(path, err)
+	}
+
+	// Older configs are upgraded in memory, SchemaVersion keeps the version
+	// on disk so saving knows to back it up first
+	if version < CONFIG_SCHEMA_VERSION {
+		if err := migrateConfigMap(raw, version); err != nil {
+			return nil, configError(path, err)
+		}
+		if blob, err = json.Marshal(raw); err != nil {
+			return nil, configError(path, err)
+		}
 	}
 
 	var conf Config
 	if err := json.Unmarshal(blob, &conf); err != nil {
-		panic(err)
+		return nil, configError(path, decodeError(path, blob, err))
 	}
 
-	return &conf
+	return &conf, nil
 }
 
-func LoadConfigMHA(path string) *[]Config {
-	blob, err := os.ReadFile(path)
+// LoadConfigMHA loads the apps of a multi-hyp project, with the defaults
+// block merged into each of them.
+func LoadConfigMHA(path string) (*[]Config, error) {
+	blob, err := readConfigFile(path)
 
 	if err != nil {
-		panic(err)
+		return nil, configError(path, err)
 	}
 
-	var confs []Config
-	if err := json.Unmarshal(blob, &confs); err != nil {
-		panic(err)
+	file, err := parseMHAFile(blob)
+	if err != nil {
+		return nil, configError(path, decodeError(path, blob, err))
+	}
+	if err := migrateMHAFile(file); err != nil {
+		return nil, configError(path, err)
+	}
+
+	shared := file.Shared
+	if shared == "" {
+		shared = DEFAULT_SHARED_DIR
 	}
 
-	return &confs
+	confs := make([]Config, len(file.Apps))
+	for i, app := range file.Apps {
+		confs[i].SharedDir = filepath.Join(filepath.Dir(path), shared)
+		merged, err := json.Marshal(mergeMaps(file.Defaults, app))
+		if err != nil {
+			return nil, configError(path, err)
+		}
+		if err := json.Unmarshal(merged, &confs[i]); err != nil {
+			// The merged app has no place in the file, validate can find it
+			return nil, configError(path, fmt.Errorf("app %d: %w, run hyp config validate for details", i, err))
+		}
+		confs[i].SchemaVersion = 0 // the file's, not the app's
+		confs[i].mhaIndex = i + 1
+	}
+
+	return &confs, nil
 }
 
+// SaveMHAConfig writes the apps of a multi-hyp project. If the file on disk
+// has a defaults block it is kept, and apps only store what they override.
 func SaveMHAConfig(path string, configs *[]Config) error {
-	file, err := os.Create(path)
+	// New projects start at the current version
+	existing := &mhaFile{SchemaVersion: CONFIG_SCHEMA_VERSION, loadedVersion: CONFIG_SCHEMA_VERSION}
+	if blob, err := readConfigFile(path); err == nil {
+		existing, err = parseMHAFile(blob)
+		if err == nil {
+			err = migrateMHAFile(existing)
+		}
+		if err != nil {
+			return configError(path, err)
+		}
+	}
 
-	if err != nil {
-		fmt.Println("Error creating file:", err)
-		return err
+	if err := backupOldConfig(path, existing.loadedVersion); err != nil {
+		return configError(path, err)
 	}
-	defer file.Close()
 
-	jsonData, err := json.MarshalIndent(configs, "", "  ")
-	if err != nil {
-		fmt.Println("Error marshalling JSON:", err)
-		return err
+	// Apps are written as they were, with only what changed applied, so
+	// nothing they inherit is pinned and their keys keep their order
+	file := *existing
+	file.Apps = make([]map[string]any, len(*configs))
+	for i, config := range *configs {
+		raw := map[string]any{}
+		var loaded map[string]any
+		if config.mhaIndex > 0 && config.mhaIndex <= len(existing.Apps) {
+			raw = existing.Apps[config.mhaIndex-1]
+			loaded = raw
+		}
+		before, err := appConfigMap(existing.Defaults, loaded)
+		if err != nil {
+			return configError(path, err)
+		}
+
+		config.SchemaVersion = 0
+		after, err := toMap(config)
+		if err != nil {
+			return configError(path, err)
+		}
+		updateMap(raw, before, after, existing.Defaults)
+		file.Apps[i] = raw
 	}
 
-	_, err = file.Write(jsonData)
-	if err != nil {
-		fmt.Println("Error writing file:", err)
-		return err
+	if err := writeConfigFile(path, file); err != nil {
+		return configError(path, err)
 	}
 	return nil
 }
 
+// SaveConfig writes the config of a single app back in the format of path.
 func SaveConfig(path string, config *Config) error {
-	file, err := os.Create(path)
+	if err := backupOldConfig(path, config.SchemaVersion); err != nil {
+		return configError(path, err)
+	}
+	config.SchemaVersion = CONFIG_SCHEMA_VERSION
+	if err := writeConfigFile(path, config); err != nil {
+		return configError(path, err)
+	}
+	return nil
+}
 
+// loadAppConfig loads the config of a single app. Multi-hyp projects hold
+// several apps, so one has to be picked by name.
+func loadAppConfig(project *Project, appName string) (*Config, error) {
+	configs, err := loadAppConfigs(project, appName)
 	if err != nil {
-		fmt.Println("Error creating file:", err)
-		return err
+		return nil, err
 	}
-	defer file.Close()
 
-	jsonData, err := json.MarshalIndent(config, "", "  ")
-	if err != nil {
-		fmt.Println("Error marshalling JSON:", err)
-		return err
+	if len(configs) > 1 {
+		return nil, &BuildError{Kind: ErrConfig, Err: fmt.Errorf("this is a multi-hyp project, pick an app with -app")}
 	}
+	return configs[0], nil
+}
 
-	_, err = file.Write(jsonData)
+// loadAppConfigs loads the apps of a project, or only the named one in a
+// multi-hyp project. Paths are made relative to each app's directory.
+func loadAppConfigs(project *Project, appName string) ([]*Config, error) {
+	if !project.MHA {
+		config, err := LoadConfig(project.ConfigPath)
+		if err != nil {
+			return nil, err
+		}
+		rebaseConfig(config, project.AppDir(config))
+		return []*Config{config}, nil
+	}
+
+	all, err := LoadConfigMHA(project.ConfigPath)
 	if err != nil {
-		fmt.Println("Error writing file:", err)
-		return err
+		return nil, err
 	}
-	return nil
+
+	var configs []*Config
+	for _, conf := range *all {
+		if appName != "" && conf.Data.Name != appName {
+			continue
+		}
+		rebaseConfig(&conf, project.AppDir(&conf))
+		configs = append(configs, &conf)
+	}
+
+	if len(configs) == 0 {
+		return nil, configError(project.ConfigPath, fmt.Errorf("no app named %q", appName))
+	}
+	return configs, nil
+}
+
+// rebaseConfig makes the paths of an app relative to its own directory, so
+// builds work from anywhere.
+func rebaseConfig(config *Config, dir string) {
+	config.Dir = dir
+	if config.Data.Model != "" {
+		config.Data.Model = config.resolvePath(config.Data.Model)
+	}
+	if config.Data.Image != "" {
+		config.Data.Image = config.resolvePath(config.Data.Image)
+	}
+	config.ScriptPath = config.resolvePath(config.ScriptPath)
+	config.AssetsPath = config.resolvePath(config.AssetsPath)
+	config.PropsPath = config.resolvePath(config.PropsPath)
+}
+
+// resolvePath makes a path from the app's files, such as a prop's initial
+// file, relative to the app directory. Paths starting with "shared:" point
+// into the shared directory of a multi-hyp project instead.
+func (c *Config) resolvePath(path string) string {
+	if rest, ok := strings.CutPrefix(path, SHARED_PREFIX); ok && c.SharedDir != "" {
+		return filepath.Join(c.SharedDir, rest)
+	}
+	if c.Dir == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(c.Dir, path)
+}
+
+// isShared tells if a resolved path is in the shared directory.
+func (c *Config) isShared(path string) bool {
+	return c.SharedDir != "" && strings.HasPrefix(path, c.SharedDir+string(filepath.Separator))
 }
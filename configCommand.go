@@ -0,0 +1,499 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const CONFIG_USAGE = "usage: hyp config validate|get|set|migrate|convert [-project path] ..."
+
+// runConfigCommand works on the project config itself.
+func runConfigCommand(args []string) error {
+	if len(args) < 1 {
+		return errors.New(CONFIG_USAGE)
+	}
+
+	switch args[0] {
+	case "validate":
+		return runConfigValidate(args[1:])
+	case "get":
+		return runConfigGet(args[1:])
+	case "set":
+		return runConfigSet(args[1:])
+	case "migrate":
+		return runConfigMigrate(args[1:])
+	case "convert":
+		return runConfigConvert(args[1:])
+	}
+	return errors.New(CONFIG_USAGE)
+}
+
+// ==================== VALIDATE ====================
+
+// configProblem is something wrong with a config, and where it is when that's
+// one spot in the file.
+type configProblem struct {
+	Line    int
+	Column  int
+	Where   string // app the problem is in, for multi-hyp projects
+	Message string
+	Warning bool
+}
+
+// format prints the problem the way compilers do, path:line:column: message.
+func (p configProblem) format(path string) string {
+	parts := []string{path}
+	if p.Line > 0 {
+		parts[0] = fmt.Sprintf("%s:%d:%d", path, p.Line, p.Column)
+	}
+	if p.Where != "" {
+		parts = append(parts, p.Where)
+	}
+	if p.Warning {
+		parts = append(parts, "warning")
+	}
+	parts = append(parts, p.Message)
+	return strings.Join(parts, ": ")
+}
+
+func runConfigValidate(args []string) error {
+	fs := flag.NewFlagSet("config validate", flag.ExitOnError)
+	projectPath := projectFlag(fs)
+	fs.Parse(args)
+
+	project, err := openProject(*projectPath)
+	if err != nil {
+		return err
+	}
+
+	problems, err := validateProject(project)
+	if err != nil {
+		return err
+	}
+
+	errorCount := 0
+	for _, p := range problems {
+		fmt.Println(p.format(project.ConfigPath))
+		if !p.Warning {
+			errorCount++
+		}
+	}
+
+	if errorCount > 0 {
+		return configError(project.ConfigPath, fmt.Errorf("%d problem(s) found", errorCount))
+	}
+	fmt.Printf("✅ %s is valid\n", project.ConfigPath)
+	return nil
+}
+
+// mhaSchema is the shape approllup.mha.json is checked against when it has a
+// defaults block.
+type mhaSchema struct {
+	Schema        string   `json:"$schema,omitempty"`
+	SchemaVersion int      `json:"schema_version"`
+	Defaults      *Config  `json:"defaults"`
+	Shared        string   `json:"shared"`
+	Apps          []Config `json:"apps"`
+}
+
+// validateProject checks a project config for unknown fields and wrong types,
+// then each app for missing fields and files.
+func validateProject(project *Project) ([]configProblem, error) {
+	blob, err := readConfigFile(project.ConfigPath)
+	if err != nil {
+		return nil, configError(project.ConfigPath, err)
+	}
+
+	var shape reflect.Type
+	switch {
+	case !project.MHA:
+		shape = reflect.TypeOf(Config{})
+	case bytes.HasPrefix(bytes.TrimSpace(blob), []byte("[")):
+		shape = reflect.TypeOf([]Config{})
+	default:
+		shape = reflect.TypeOf(mhaSchema{})
+	}
+
+	problems := checkJSONShape(blob, shape)
+	if configFormat(project.ConfigPath) != CONFIG_JSON {
+		// Positions are in the converted JSON, the field names still say where
+		for i := range problems {
+			problems[i].Line, problems[i].Column = 0, 0
+		}
+	}
+
+	// Wrong types keep the config from loading, and are already reported
+	configs, err := loadRawConfigs(project)
+	if err != nil {
+		if len(problems) > 0 {
+			return problems, nil
+		}
+		return nil, err
+	}
+
+	for i := range configs {
+		config := &configs[i]
+		where := ""
+		if project.MHA {
+			where = "app " + config.Data.Name
+			if config.Data.Name == "" {
+				where = fmt.Sprintf("app %d", i)
+			}
+		}
+
+		missing := requiredFields(config)
+		for _, err := range missing {
+			problems = append(problems, configProblem{Where: where, Message: err.Error()})
+		}
+		if len(missing) > 0 {
+			continue
+		}
+
+		rebaseConfig(config, project.AppDir(config))
+		checks := append(checkConfigPaths(config), checkProfiles(config)...)
+		for _, p := range append(checks, checkDefines(config)...) {
+			p.Where = where
+			problems = append(problems, p)
+		}
+	}
+
+	return problems, nil
+}
+
+// loadRawConfigs loads the apps of a project with their paths as written.
+func loadRawConfigs(project *Project) ([]Config, error) {
+	if project.MHA {
+		all, err := LoadConfigMHA(project.ConfigPath)
+		if err != nil {
+			return nil, err
+		}
+		return *all, nil
+	}
+
+	config, err := LoadConfig(project.ConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	return []Config{*config}, nil
+}
+
+// requiredFields lists the fields an app can't be built without.
+func requiredFields(config *Config) []error {
+	var errs []error
+	required := []struct {
+		name  string
+		value string
+	}{
+		{"data.name", config.Data.Name},
+		{"data.model", config.Data.Model},
+		{"script_path", config.ScriptPath},
+		{"props_path", config.PropsPath},
+	}
+	for _, r := range required {
+		if strings.TrimSpace(r.value) == "" {
+			errs = append(errs, fmt.Errorf("%s is required", r.name))
+		}
+	}
+	return errs
+}
+
+// checkConfigPaths checks the files an app points at are there. The script is
+// only made by rollup, so it missing is a warning.
+func checkConfigPaths(config *Config) []configProblem {
+	var problems []configProblem
+	missing := func(path string, what string, warning bool) {
+		if _, err := os.Stat(path); err != nil {
+			problems = append(problems, configProblem{Message: fmt.Sprintf("%s %s doesn't exist", what, path), Warning: warning})
+		}
+	}
+
+	missing(config.Data.Model, "model", false)
+	if config.Data.Image != "" {
+		missing(config.Data.Image, "image", false)
+	}
+	if _, err := os.Stat(config.ScriptPath); err != nil {
+		problems = append(problems, configProblem{Message: fmt.Sprintf("script %s doesn't exist, has rollup been run?", config.ScriptPath), Warning: true})
+	}
+	if config.AssetsPath != config.Dir {
+		missing(config.AssetsPath, "assets directory", true)
+	}
+
+	props, err := loadProps(config.PropsPath)
+	if err != nil {
+		return append(problems, configProblem{Message: err.Error()})
+	}
+	for _, prop := range props {
+		initial, ok := prop["initial"].(string)
+		if prop["type"] != "file" || !ok || initial == "" {
+			continue
+		}
+		missing(config.resolvePath(initial), fmt.Sprintf("initial file of prop %v", prop["key"]), false)
+	}
+
+	return problems
+}
+
+// checkProfiles checks profiles only override fields and props that exist.
+// Profile data is a plain object, so the shape check doesn't look inside it.
+func checkProfiles(config *Config) []configProblem {
+	var problems []configProblem
+	fields := jsonFields(reflect.TypeOf(MetaData{}))
+	props, _ := loadProps(config.PropsPath) // a broken props.json is already reported
+
+	for _, name := range config.profileNames() {
+		profile := config.Profiles[name]
+		if profile == nil {
+			continue
+		}
+		for key := range profile.Data {
+			if _, ok := fields[key]; !ok {
+				problems = append(problems, configProblem{Message: fmt.Sprintf("profiles.%s.data: unknown field %q", name, key)})
+			}
+		}
+		for key := range profile.Props {
+			if !slices.ContainsFunc(props, func(p Prop) bool { return p["key"] == key }) {
+				problems = append(problems, configProblem{Message: fmt.Sprintf("profiles.%s.props: no prop %q in %s", name, key, config.PropsPath)})
+			}
+		}
+		if len(profile.BuildCommand) > 0 && strings.TrimSpace(profile.BuildCommand[0]) == "" {
+			problems = append(problems, configProblem{Message: fmt.Sprintf("profiles.%s.build_command: the program is empty", name)})
+		}
+	}
+	return problems
+}
+
+// checkDefines checks define names are identifiers and their values only use
+// known tokens, in the app and in each profile.
+func checkDefines(config *Config) []configProblem {
+	var problems []configProblem
+	check := func(where string, defines map[string]string) {
+		for _, name := range sortedKeys(defines) {
+			if !defineName.MatchString(name) {
+				problems = append(problems, configProblem{Message: fmt.Sprintf("%s: %q isn't a valid identifier", where, name)})
+			}
+			for _, token := range templateToken.FindAllStringSubmatch(defines[name], -1) {
+				if !slices.Contains(DEFINE_TOKENS, token[1]) {
+					problems = append(problems, configProblem{Message: fmt.Sprintf("%s.%s: unknown {%s}", where, name, token[1])})
+				}
+			}
+		}
+	}
+
+	check("defines", config.Defines)
+	for _, name := range config.profileNames() {
+		if profile := config.Profiles[name]; profile != nil {
+			check("profiles."+name+".defines", profile.Defines)
+		}
+	}
+	return problems
+}
+
+// ==================== JSON SHAPE ====================
+
+// checkJSONShape walks a JSON document next to the Go type it decodes into,
+// reporting unknown fields and values of the wrong type with their position.
+func checkJSONShape(blob []byte, t reflect.Type) []configProblem {
+	dec := json.NewDecoder(bytes.NewReader(blob))
+	dec.UseNumber()
+	w := &shapeWalker{dec: dec, blob: blob}
+
+	if err := w.walk(t, ""); err != nil && err != io.EOF {
+		line, col := lineColumn(blob, int(dec.InputOffset()))
+		var syntax *json.SyntaxError
+		if errors.As(err, &syntax) {
+			line, col = lineColumn(blob, int(syntax.Offset))
+		}
+		w.problems = append(w.problems, configProblem{Line: line, Column: col, Message: "syntax error: " + err.Error()})
+	}
+
+	sort.SliceStable(w.problems, func(i, j int) bool {
+		a, b := w.problems[i], w.problems[j]
+		return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+	})
+	return w.problems
+}
+
+type shapeWalker struct {
+	dec      *json.Decoder
+	blob     []byte
+	problems []configProblem
+}
+
+// next is where the next token starts, past whitespace and separators.
+func (w *shapeWalker) next() int {
+	off := int(w.dec.InputOffset())
+	for off < len(w.blob) && strings.IndexByte(" \t\r\n,:", w.blob[off]) >= 0 {
+		off++
+	}
+	return off
+}
+
+func (w *shapeWalker) problem(offset int, format string, args ...any) {
+	line, col := lineColumn(w.blob, offset)
+	w.problems = append(w.problems, configProblem{Line: line, Column: col, Message: fmt.Sprintf(format, args...)})
+}
+
+// walk reads one value, checking it against t. A nil t accepts anything.
+func (w *shapeWalker) walk(t reflect.Type, name string) error {
+	start := w.next()
+	tok, err := w.dec.Token()
+	if err != nil {
+		return err
+	}
+
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || tok == nil || t.Kind() == reflect.Interface || t.Kind() == reflect.Map {
+		return w.skip(tok)
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if tok != json.Delim('{') {
+			w.problem(start, "%s should be an object, not %s", describeField(name), describeToken(tok))
+			return w.skip(tok)
+		}
+		fields := jsonFields(t)
+		for w.dec.More() {
+			keyStart := w.next()
+			keyTok, err := w.dec.Token()
+			if err != nil {
+				return err
+			}
+			key, _ := keyTok.(string)
+			path := strings.TrimPrefix(name+"."+key, ".")
+
+			field, known := fields[key]
+			if !known {
+				w.problem(keyStart, "unknown field %q", path)
+			}
+			if err := w.walk(field, path); err != nil {
+				return err
+			}
+		}
+		_, err = w.dec.Token()
+		return err
+
+	case reflect.Slice:
+		if tok != json.Delim('[') {
+			w.problem(start, "%s should be a list, not %s", describeField(name), describeToken(tok))
+			return w.skip(tok)
+		}
+		for i := 0; w.dec.More(); i++ {
+			if err := w.walk(t.Elem(), fmt.Sprintf("%s[%d]", name, i)); err != nil {
+				return err
+			}
+		}
+		_, err = w.dec.Token()
+		return err
+
+	case reflect.String:
+		if _, ok := tok.(string); !ok {
+			w.problem(start, "%s should be a string, not %s", describeField(name), describeToken(tok))
+		}
+	case reflect.Bool:
+		if _, ok := tok.(bool); !ok {
+			w.problem(start, "%s should be true or false, not %s", describeField(name), describeToken(tok))
+		}
+	case reflect.Int:
+		n, ok := tok.(json.Number)
+		if _, err := n.Int64(); !ok || err != nil {
+			w.problem(start, "%s should be a whole number, not %s", describeField(name), describeToken(tok))
+		}
+	}
+
+	return w.skip(tok)
+}
+
+// skip reads past the rest of a value whose first token was tok.
+func (w *shapeWalker) skip(tok json.Token) error {
+	if tok != json.Delim('{') && tok != json.Delim('[') {
+		return nil
+	}
+
+	for depth := 1; depth > 0; {
+		tok, err := w.dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+	return nil
+}
+
+// jsonFields maps the JSON names of a struct's fields to their types.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+func describeField(name string) string {
+	if name == "" {
+		return "the config"
+	}
+	return name
+}
+
+func describeToken(tok json.Token) string {
+	switch v := tok.(type) {
+	case json.Delim:
+		if v == '{' {
+			return "an object"
+		}
+		return "a list"
+	case string:
+		return fmt.Sprintf("%q", v)
+	case nil:
+		return "null"
+	}
+	return fmt.Sprint(tok)
+}
+
+// lineColumn turns a byte offset into a 1-based line and column.
+func lineColumn(blob []byte, offset int) (int, int) {
+	offset = min(offset, len(blob))
+	line := 1 + bytes.Count(blob[:offset], []byte("\n"))
+	col := offset - bytes.LastIndexByte(blob[:offset], '\n')
+	return line, col
+}
+
+// jsonError adds the line and column to JSON decoding errors.
+func jsonError(blob []byte, err error) error {
+	var syntax *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntax):
+		line, col := lineColumn(blob, int(syntax.Offset))
+		return fmt.Errorf("line %d, column %d: %w", line, col, err)
+	case errors.As(err, &typeErr):
+		line, col := lineColumn(blob, int(typeErr.Offset))
+		return fmt.Errorf("line %d, column %d: %w", line, col, err)
+	}
+	return err
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// configPathPart matches one step of a config path, a field name or [selector].
+var configPathPart = regexp.MustCompile(`([^.\[\]]+)|\[([^\]]*)\]`)
+
+// splitConfigPath splits "apps[name].data.preload" into apps, [name], data, preload.
+func splitConfigPath(path string) ([]string, error) {
+	var keys []string
+	rest := path
+	for rest != "" {
+		rest = strings.TrimPrefix(rest, ".")
+		loc := configPathPart.FindStringIndex(rest)
+		if loc == nil || loc[0] != 0 {
+			return nil, fmt.Errorf("can't read config path %q", path)
+		}
+		keys = append(keys, rest[:loc[1]])
+		rest = rest[loc[1]:]
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("the config path is empty")
+	}
+	return keys, nil
+}
+
+// configField finds the field at keys below v by JSON names, or the entry of a
+// map, such as defines.FOO. Nil structs and missing entries on the way give
+// the zero Value.
+func configField(v reflect.Value, keys []string) (reflect.Value, error) {
+	for i, key := range keys {
+		for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				return reflect.Value{}, nil
+			}
+			v = v.Elem()
+		}
+
+		switch v.Kind() {
+		case reflect.Map:
+			v = v.MapIndex(reflect.ValueOf(mapKey(key)))
+			if !v.IsValid() {
+				return reflect.Value{}, nil
+			}
+		case reflect.Struct:
+			field, ok := structFieldByJSON(v.Type(), key)
+			if !ok {
+				return reflect.Value{}, fmt.Errorf("unknown field %q", strings.Join(keys[:i+1], "."))
+			}
+			v = v.FieldByIndex(field.Index)
+		default:
+			return reflect.Value{}, fmt.Errorf("%s has no field %q", strings.Join(keys[:i], "."), key)
+		}
+	}
+	return v, nil
+}
+
+// setConfigField sets the field or map entry at keys below v from a string,
+// see setFromString, and returns the value it ended up with. Nil structs and
+// maps on the way are made. Map entries can't be changed in place, so they're
+// set on a copy that is stored back.
+func setConfigField(v reflect.Value, keys []string, value string) (reflect.Value, error) {
+	return setConfigFieldAt(v, keys, 0, value)
+}
+
+func setConfigFieldAt(v reflect.Value, keys []string, i int, value string) (reflect.Value, error) {
+	if i == len(keys) {
+		if err := setFromString(v, value); err != nil {
+			return reflect.Value{}, fmt.Errorf("%s: %w", strings.Join(keys, "."), err)
+		}
+		return v, nil
+	}
+	key := keys[i]
+
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+
+	if v.Kind() == reflect.Interface {
+		// Objects in free-form sections like a profile's data
+		if _, ok := v.Interface().(map[string]any); !ok {
+			v.Set(reflect.ValueOf(map[string]any{}))
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Map:
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		k := reflect.ValueOf(mapKey(key))
+		elem := reflect.New(v.Type().Elem()).Elem()
+		if current := v.MapIndex(k); current.IsValid() {
+			elem.Set(current)
+		}
+		set, err := setConfigFieldAt(elem, keys, i+1, value)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v.SetMapIndex(k, elem)
+		return set, nil
+	case reflect.Struct:
+		field, ok := structFieldByJSON(v.Type(), key)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("unknown field %q", strings.Join(keys[:i+1], "."))
+		}
+		return setConfigFieldAt(v.FieldByIndex(field.Index), keys, i+1, value)
+	}
+	return reflect.Value{}, fmt.Errorf("%s has no field %q", strings.Join(keys[:i], "."), key)
+}
+
+// mapKey is a map key as given in a config path, where [key] lets it hold dots.
+func mapKey(key string) string {
+	if inner, ok := strings.CutPrefix(key, "["); ok {
+		return strings.TrimSuffix(inner, "]")
+	}
+	return key
+}
+
+func structFieldByJSON(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if f.IsExported() && tag != "-" && tag == name {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// setFromString parses value into v according to its type. Objects are given
+// as JSON, and null clears optional sections.
+func setFromString(v reflect.Value, value string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q isn't a whole number", value)
+		}
+		v.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q isn't true or false", value)
+		}
+		v.SetBool(b)
+	case reflect.Interface:
+		// Free-form values are JSON when they parse as it, text otherwise
+		var parsed any
+		if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+			parsed = value
+		}
+		if parsed == nil {
+			v.SetZero()
+		} else {
+			v.Set(reflect.ValueOf(parsed))
+		}
+	default:
+		target := reflect.New(v.Type())
+		if err := json.Unmarshal([]byte(value), target.Interface()); err != nil {
+			return fmt.Errorf("expected JSON for %s: %w", v.Type(), err)
+		}
+		v.Set(target.Elem())
+	}
+	return nil
+}
+
+// printConfigValue prints scalars as they are and anything else as JSON.
+func printConfigValue(v any) error {
+	switch v.(type) {
+	case string, bool, int, float64, json.Number:
+		fmt.Println(v)
+		return nil
+	}
+
+	blob, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(blob))
+	return nil
+}
+
+// ==================== COMMANDS ====================
+
+func runConfigGet(args []string) error {
+	fs := flag.NewFlagSet("config get", flag.ExitOnError)
+	projectPath := projectFlag(fs)
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return errors.New("usage: hyp config get [-project path] <path>")
+	}
+
+	project, err := openProject(*projectPath)
+	if err != nil {
+		return err
+	}
+	keys, err := splitConfigPath(fs.Arg(0))
+	if err != nil {
+		return &BuildError{Kind: ErrConfig, Err: err}
+	}
+
+	value, err := getConfigValue(project, keys)
+	if err != nil {
+		return configError(project.ConfigPath, err)
+	}
+	return printConfigValue(value)
+}
+
+func runConfigSet(args []string) error {
+	fs := flag.NewFlagSet("config set", flag.ExitOnError)
+	projectPath := projectFlag(fs)
+	fs.Parse(args)
+
+	args = fs.Args()
+	if len(args) == 1 {
+		// hyp config set defines.FOO=1
+		if path, value, ok := strings.Cut(args[0], "="); ok {
+			args = []string{path, value}
+		}
+	}
+	if len(args) != 2 {
+		return errors.New("usage: hyp config set [-project path] <path> <value>, or <path>=<value>")
+	}
+
+	project, err := openProject(*projectPath)
+	if err != nil {
+		return err
+	}
+	keys, err := splitConfigPath(args[0])
+	if err != nil {
+		return &BuildError{Kind: ErrConfig, Err: err}
+	}
+
+	if err := setConfigValue(project, keys, args[1]); err != nil {
+		return configError(project.ConfigPath, err)
+	}
+	fmt.Printf("Set %s in %s\n", args[0], project.ConfigPath)
+	return nil
+}
+
+func getConfigValue(project *Project, keys []string) (any, error) {
+	if !project.MHA {
+		config, err := LoadConfig(project.ConfigPath)
+		if err != nil {
+			return nil, err
+		}
+		return structValue(reflect.ValueOf(config).Elem(), keys)
+	}
+
+	switch keys[0] {
+	case "defaults", "shared":
+		file, err := readMHAFile(project.ConfigPath)
+		if err != nil {
+			return nil, err
+		}
+		if keys[0] == "shared" {
+			return file.Shared, nil
+		}
+		return mapValue(file.Defaults, keys[1:])
+
+	case "apps":
+		configs, err := LoadConfigMHA(project.ConfigPath)
+		if err != nil {
+			return nil, err
+		}
+		if len(keys) == 1 {
+			return configs, nil
+		}
+		i, err := findAppBySelector(*configs, keys[1])
+		if err != nil {
+			return nil, err
+		}
+		return structValue(reflect.ValueOf(&(*configs)[i]).Elem(), keys[2:])
+	}
+	return nil, fmt.Errorf("unknown field %q, a multi-hyp project has defaults, shared and apps[name]", keys[0])
+}
+
+func setConfigValue(project *Project, keys []string, value string) error {
+	if !project.MHA {
+		config, err := LoadConfig(project.ConfigPath)
+		if err != nil {
+			return err
+		}
+		if _, err := setConfigField(reflect.ValueOf(config).Elem(), keys, value); err != nil {
+			return err
+		}
+		return SaveConfig(project.ConfigPath, config)
+	}
+
+	switch keys[0] {
+	case "defaults", "shared":
+		file, err := readMHAFile(project.ConfigPath)
+		if err != nil {
+			return err
+		}
+		if keys[0] == "shared" {
+			file.Shared = value
+		} else {
+			if file.Defaults == nil {
+				return errors.New("this project has no defaults block, set values on apps[name] instead")
+			}
+			if err := setMapValue(file.Defaults, keys[1:], value); err != nil {
+				return err
+			}
+		}
+		return writeMHAFile(project.ConfigPath, file)
+
+	case "apps":
+		if len(keys) < 3 {
+			return errors.New("pick a field of an app, e.g. apps[name].app_version")
+		}
+		configs, err := LoadConfigMHA(project.ConfigPath)
+		if err != nil {
+			return err
+		}
+		i, err := findAppBySelector(*configs, keys[1])
+		if err != nil {
+			return err
+		}
+		if _, err := setConfigField(reflect.ValueOf(&(*configs)[i]).Elem(), keys[2:], value); err != nil {
+			return err
+		}
+		return SaveMHAConfig(project.ConfigPath, configs)
+	}
+	return fmt.Errorf("unknown field %q, a multi-hyp project has defaults, shared and apps[name]", keys[0])
+}
+
+// findAppBySelector picks an app by the name in [name], or by its position.
+func findAppBySelector(configs []Config, selector string) (int, error) {
+	name, ok := strings.CutPrefix(selector, "[")
+	name, closed := strings.CutSuffix(name, "]")
+	if !ok || !closed {
+		return -1, fmt.Errorf("expected apps[name], got apps.%s", selector)
+	}
+
+	if i := slices.IndexFunc(configs, func(c Config) bool { return c.Data.Name == name }); i >= 0 {
+		return i, nil
+	}
+	if i, err := strconv.Atoi(name); err == nil && i >= 0 && i < len(configs) {
+		return i, nil
+	}
+	return -1, fmt.Errorf("no app named %q", name)
+}
+
+func structValue(v reflect.Value, keys []string) (any, error) {
+	field, err := configField(v, keys)
+	if err != nil {
+		return nil, err
+	}
+	if !field.IsValid() {
+		return nil, nil
+	}
+	return field.Interface(), nil
+}
+
+func mapValue(m map[string]any, keys []string) (any, error) {
+	var value any = m
+	for _, key := range keys {
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%q isn't an object", key)
+		}
+		value = obj[mapKey(key)]
+	}
+	return value, nil
+}
+
+// setMapValue sets a value in a raw config map, coercing it to the type the
+// Config field at that path has.
+func setMapValue(m map[string]any, keys []string, value string) error {
+	if len(keys) == 0 {
+		return errors.New("pick a field of the defaults, e.g. defaults.data.author")
+	}
+
+	field, err := setConfigField(reflect.New(reflect.TypeOf(Config{})).Elem(), keys, value)
+	if err != nil {
+		return err
+	}
+
+	// Store it the way it would have been decoded from the file
+	blob, err := json.Marshal(field.Interface())
+	if err != nil {
+		return err
+	}
+	var generic any
+	if err := json.Unmarshal(blob, &generic); err != nil {
+		return err
+	}
+
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := m[mapKey(key)].(map[string]any)
+		if !ok {
+			next = map[string]any{}
+			m[mapKey(key)] = next
+		}
+		m = next
+	}
+	m[mapKey(keys[len(keys)-1])] = generic
+	return nil
+}
+
+func readMHAFile(path string) (*mhaFile, error) {
+	blob, err := readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := parseMHAFile(blob)
+	if err != nil {
+		return nil, decodeError(path, blob, err)
+	}
+	if err := migrateMHAFile(file); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func writeMHAFile(path string, file *mhaFile) error {
+	if err := backupOldConfig(path, file.loadedVersion); err != nil {
+		return err
+	}
+	file.loadedVersion = CONFIG_SCHEMA_VERSION
+	return writeConfigFile(path, file)
+}
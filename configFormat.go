@@ -0,0 +1,474 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Project configs can be written as JSON, YAML or TOML. Everything past
+// reading and writing the file works on JSON, so the other formats are
+// converted on the way in and out.
+const (
+	CONFIG_JSON = "json"
+	CONFIG_YAML = "yaml"
+	CONFIG_TOML = "toml"
+)
+
+// CONFIG_EXTENSIONS are looked for after approllup and approllup.mha, in order.
+var CONFIG_EXTENSIONS = []string{".json", ".yaml", ".yml", ".toml"}
+
+// configFormat picks the format of a config file by its extension.
+func configFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return CONFIG_YAML
+	case ".toml":
+		return CONFIG_TOML
+	}
+	return CONFIG_JSON
+}
+
+// isMHAConfig tells if a config file name is a multi-hyp project's.
+func isMHAConfig(path string) bool {
+	base := filepath.Base(path)
+	return strings.HasSuffix(strings.TrimSuffix(base, filepath.Ext(base)), ".mha")
+}
+
+// readConfigFile reads a config file as JSON, whatever format it's written in.
+func readConfigFile(path string) ([]byte, error) {
+	blob, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc any
+	switch configFormat(path) {
+	case CONFIG_JSON:
+		return blob, nil
+	case CONFIG_YAML:
+		err = yaml.Unmarshal(blob, &doc)
+	case CONFIG_TOML:
+		var table map[string]any
+		_, err = toml.Decode(string(blob), &table)
+		doc = table
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err = jsonKeys(doc)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// jsonKeys turns the maps YAML may decode with non-string keys into ones
+// encoding/json can write.
+func jsonKeys(v any) (any, error) {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, item := range v {
+			item, err := jsonKeys(item)
+			if err != nil {
+				return nil, err
+			}
+			v[k] = item
+		}
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for k, item := range v {
+			item, err := jsonKeys(item)
+			if err != nil {
+				return nil, err
+			}
+			m[fmt.Sprint(k)] = item
+		}
+		return m, nil
+	case []any:
+		for i, item := range v {
+			item, err := jsonKeys(item)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = item
+		}
+	case []map[string]any:
+		for _, item := range v {
+			if _, err := jsonKeys(item); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return v, nil
+}
+
+// decodeError is jsonError for files that are JSON on disk. Positions in the
+// converted YAML or TOML wouldn't point anywhere useful.
+func decodeError(path string, blob []byte, err error) error {
+	if configFormat(path) == CONFIG_JSON {
+		return jsonError(blob, err)
+	}
+	return err
+}
+
+// writeConfigFile writes v to a config file in the format its extension
+// names. Keys of a JSON or YAML file being overwritten keep their order, and
+// YAML comments are carried over to the keys that are still there. The TOML
+// encoder has no way to keep comments, so a TOML file with any is refused.
+func writeConfigFile(path string, v any) error {
+	blob, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	switch configFormat(path) {
+	case CONFIG_JSON:
+		blob, err = encodeJSON(path, blob)
+	case CONFIG_YAML:
+		blob, err = encodeYAML(path, blob)
+	case CONFIG_TOML:
+		if current, err := os.ReadFile(path); err == nil && tomlHasComments(current) {
+			return errors.New("the file has comments, which saving it as TOML would lose. Edit it by hand, or convert it to YAML, which keeps them, with hyp config convert -to yaml")
+		}
+		blob, err = encodeTOML(blob)
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, blob, 0666)
+}
+
+// currentDoc reads the config file about to be overwritten as a YAML node,
+// which JSON files also parse as. It's nil when there's none to read.
+func currentDoc(path string) *yaml.Node {
+	current, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var old yaml.Node
+	if yaml.Unmarshal(current, &old) != nil {
+		return nil
+	}
+	return &old
+}
+
+// encodeJSON reindents JSON, keeping the order of the keys in the file it
+// replaces.
+func encodeJSON(path string, blob []byte) ([]byte, error) {
+	old := currentDoc(path)
+	if old == nil {
+		return blob, nil
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(blob, &doc); err != nil {
+		return nil, err
+	}
+	keepKeyOrder(&doc, old)
+
+	var buf bytes.Buffer
+	writeNodeJSON(&buf, &doc, "")
+	return buf.Bytes(), nil
+}
+
+// writeNodeJSON writes a node decoded from JSON back as JSON, indented the
+// way json.MarshalIndent would.
+func writeNodeJSON(buf *bytes.Buffer, n *yaml.Node, indent string) {
+	inner := indent + "  "
+	switch n.Kind {
+	case yaml.DocumentNode:
+		for _, c := range n.Content {
+			writeNodeJSON(buf, c, indent)
+		}
+	case yaml.MappingNode, yaml.SequenceNode:
+		open, close, step := "{", "}", 2
+		if n.Kind == yaml.SequenceNode {
+			open, close, step = "[", "]", 1
+		}
+		if len(n.Content) == 0 {
+			buf.WriteString(open + close)
+			return
+		}
+		buf.WriteString(open)
+		for i := 0; i < len(n.Content); i += step {
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			buf.WriteString("\n" + inner)
+			if step == 2 {
+				key, _ := json.Marshal(n.Content[i].Value)
+				buf.Write(key)
+				buf.WriteString(": ")
+			}
+			writeNodeJSON(buf, n.Content[i+step-1], inner)
+		}
+		buf.WriteString("\n" + indent + close)
+	default:
+		if n.Tag == "!!str" {
+			value, _ := json.Marshal(n.Value)
+			buf.Write(value)
+		} else {
+			buf.WriteString(n.Value)
+		}
+	}
+}
+
+// keepKeyOrder sorts the keys of n into the order the same keys have in old.
+// Keys old doesn't have go after the others, in the order they're in.
+func keepKeyOrder(n *yaml.Node, old *yaml.Node) {
+	switch {
+	case n.Kind == yaml.DocumentNode && old.Kind == yaml.DocumentNode, n.Kind == yaml.SequenceNode && old.Kind == yaml.SequenceNode:
+		for i := range min(len(n.Content), len(old.Content)) {
+			keepKeyOrder(n.Content[i], old.Content[i])
+		}
+	case n.Kind == yaml.MappingNode && old.Kind == yaml.MappingNode:
+		position := map[string]int{}
+		oldValues := map[string]*yaml.Node{}
+		for j := 0; j+1 < len(old.Content); j += 2 {
+			position[old.Content[j].Value] = j / 2
+			oldValues[old.Content[j].Value] = old.Content[j+1]
+		}
+
+		pairs := make([][2]*yaml.Node, 0, len(n.Content)/2)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			pairs = append(pairs, [2]*yaml.Node{n.Content[i], n.Content[i+1]})
+		}
+		rank := func(key string) int {
+			if p, ok := position[key]; ok {
+				return p
+			}
+			return len(position)
+		}
+		sort.SliceStable(pairs, func(a, b int) bool { return rank(pairs[a][0].Value) < rank(pairs[b][0].Value) })
+
+		n.Content = n.Content[:0]
+		for _, pair := range pairs {
+			if old, ok := oldValues[pair[0].Value]; ok {
+				keepKeyOrder(pair[1], old)
+			}
+			n.Content = append(n.Content, pair[0], pair[1])
+		}
+	}
+}
+
+// encodeYAML turns JSON into block style YAML, keeping the order of the keys.
+func encodeYAML(path string, blob []byte) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(blob, &doc); err != nil {
+		return nil, err
+	}
+	blockStyle(&doc)
+
+	if old := currentDoc(path); old != nil {
+		keepKeyOrder(&doc, old)
+		copyComments(&doc, old)
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// blockStyle drops the flow style and quoting JSON decodes with. The encoder
+// still quotes strings that would read back as another type.
+func blockStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		blockStyle(c)
+	}
+}
+
+// copyComments copies the comments of old onto the same keys in n.
+func copyComments(n *yaml.Node, old *yaml.Node) {
+	n.HeadComment, n.LineComment, n.FootComment = old.HeadComment, old.LineComment, old.FootComment
+
+	switch {
+	case n.Kind == yaml.DocumentNode && old.Kind == yaml.DocumentNode, n.Kind == yaml.SequenceNode && old.Kind == yaml.SequenceNode:
+		for i := range min(len(n.Content), len(old.Content)) {
+			copyComments(n.Content[i], old.Content[i])
+		}
+	case n.Kind == yaml.MappingNode && old.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			for j := 0; j+1 < len(old.Content); j += 2 {
+				if n.Content[i].Value == old.Content[j].Value {
+					copyComments(n.Content[i], old.Content[j])
+					copyComments(n.Content[i+1], old.Content[j+1])
+					break
+				}
+			}
+		}
+	}
+}
+
+// encodeTOML turns JSON into TOML. TOML has no null, so values unset on
+// purpose, like an app clearing a default, can't be written.
+func encodeTOML(blob []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(blob))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	table, ok := doc.(map[string]any)
+	if !ok {
+		return nil, errors.New("TOML needs a table at the top, not a list")
+	}
+	if err := tomlValues(table, ""); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	enc := toml.NewEncoder(&buf)
+	enc.Indent = ""
+	if err := enc.Encode(table); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// tomlHasComments tells if a TOML file has a comment, a # outside strings.
+func tomlHasComments(src []byte) bool {
+	for i := 0; i < len(src); i++ {
+		switch src[i] {
+		case '#':
+			return true
+		case '"', '\'':
+			quote := src[i : i+1]
+			if bytes.HasPrefix(src[i:], bytes.Repeat(quote, 3)) {
+				quote = bytes.Repeat(quote, 3)
+			}
+			for i += len(quote); i < len(src) && !bytes.HasPrefix(src[i:], quote); i++ {
+				// Only basic strings have escapes
+				if src[i] == '\\' && quote[0] == '"' {
+					i++
+				}
+			}
+			i += len(quote) - 1
+		}
+	}
+	return false
+}
+
+// tomlValues turns JSON numbers into ints where they're whole, so versions
+// aren't written as 1.0, and fails on nulls.
+func tomlValues(v any, name string) error {
+	switch v := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if err := tomlValues(v[k], strings.TrimPrefix(name+"."+k, ".")); err != nil {
+				return err
+			}
+			v[k] = tomlNumber(v[k])
+		}
+	case []any:
+		for i := range v {
+			if err := tomlValues(v[i], fmt.Sprintf("%s[%d]", name, i)); err != nil {
+				return err
+			}
+			v[i] = tomlNumber(v[i])
+		}
+	case nil:
+		return fmt.Errorf("%s is null, which TOML can't hold, use YAML or JSON for this project", name)
+	}
+	return nil
+}
+
+func tomlNumber(v any) any {
+	n, ok := v.(json.Number)
+	if !ok {
+		return v
+	}
+	if i, err := n.Int64(); err == nil {
+		return i
+	}
+	f, _ := n.Float64()
+	return f
+}
+
+// ==================== COMMAND ====================
+
+var configExtensions = map[string]string{CONFIG_JSON: ".json", CONFIG_YAML: ".yaml", CONFIG_TOML: ".toml"}
+
+// runConfigConvert rewrites the project config in another format. The old
+// file is renamed out of the way, two configs in one directory is an error.
+func runConfigConvert(args []string) error {
+	fs := flag.NewFlagSet("config convert", flag.ExitOnError)
+	to := fs.String("to", "", "Format to convert to: json, yaml or toml")
+	projectPath := projectFlag(fs)
+	fs.Parse(args)
+
+	format := strings.ToLower(*to)
+	ext, ok := configExtensions[format]
+	if !ok {
+		return errors.New("usage: hyp config convert -to json|yaml|toml [-project path]")
+	}
+
+	project, err := openProject(*projectPath)
+	if err != nil {
+		return err
+	}
+	path := project.ConfigPath
+	if configFormat(path) == format {
+		fmt.Printf("%s is already %s\n", path, format)
+		return nil
+	}
+
+	target := strings.TrimSuffix(path, filepath.Ext(path)) + ext
+	if _, err := os.Stat(target); err == nil {
+		return configError(target, errors.New("already exists"))
+	}
+
+	if project.MHA {
+		var file *mhaFile
+		file, err = readMHAFile(path)
+		if err != nil {
+			return configError(path, err)
+		}
+		if err = writeMHAFile(target, file); err != nil {
+			err = configError(target, err)
+		}
+	} else {
+		var config *Config
+		config, err = LoadConfig(path)
+		if err != nil {
+			return err
+		}
+		err = SaveConfig(target, config)
+	}
+	if err != nil {
+		os.Remove(target)
+		return err
+	}
+
+	backup := path + ".bak"
+	if err := os.Rename(path, backup); err != nil {
+		return configError(path, err)
+	}
+
+	fmt.Printf("Converted %s to %s, the old file is in %s\n", path, target, backup)
+	return nil
+}
@@ -37,32 +37,41 @@ func generateConfig() *Config {
 	return &config
 }
 
-func createMHASub() {
-	root, err := os.Getwd()
+func createMHASub(projectPath string) error {
+	project, err := openProject(projectPath)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	if !project.MHA {
+		return configError(project.ConfigPath, fmt.Errorf("apps can only be added to a multi-hyp project"))
+	}
+
+	root := project.Dir
+	mha_path := project.ConfigPath
+	configs, err := LoadConfigMHA(mha_path)
+	if err != nil {
+		return err
 	}
 
 	new_config := generateConfig()
-	mha_path := filepath.Join(root, APPROLLUP_MHA_NAME)
-	configs := LoadConfigMHA(mha_path)
 	*configs = append(*configs, *new_config)
 
 	app_dir := filepath.Join(root, new_config.Data.Name)
-	os.MkdirAll(app_dir, 0777)
-
-	CloneRepo(app_dir, TEMPLATE_URL, "main")
+	if err := os.MkdirAll(app_dir, 0777); err != nil {
+		return err
+	}
 
-	err = SaveMHAConfig(mha_path, configs)
-	if err != nil {
-		panic(err)
+	if err := CloneRepo(app_dir, TEMPLATE_URL, "main"); err != nil {
+		return err
 	}
+
+	return SaveMHAConfig(mha_path, configs)
 }
 
-func runCreateApp(isMHA bool) {
+func runCreateApp(isMHA bool) error {
 	dir, err := os.Getwd()
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	root_name := ""
@@ -82,9 +91,13 @@ func runCreateApp(isMHA bool) {
 		config_path = filepath.Join(dir, root_name, rollup_name)
 	}
 
-	os.MkdirAll(app_dir, 0777)
+	if err := os.MkdirAll(app_dir, 0777); err != nil {
+		return err
+	}
 
-	CloneRepo(app_dir, TEMPLATE_URL, "main")
+	if err := CloneRepo(app_dir, TEMPLATE_URL, "main"); err != nil {
+		return err
+	}
 
 	if !isMHA {
 		err = SaveConfig(config_path, config)
@@ -95,10 +108,11 @@ func runCreateApp(isMHA bool) {
 	}
 
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	fmt.Println("✅ Project initialized! Configuration saved to config.json")
+	fmt.Println("✅ Project initialized! Configuration saved to", config_path)
+	return nil
 }
 
 func promptInput[T any](label string, defaultValue T) T {
@@ -2,11 +2,11 @@ package main
 
 import "os"
 
-func createWorld(gitRepo string, branch string) {
+func createWorld(gitRepo string, branch string) error {
 	dir, err := os.Getwd()
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	CloneRepo(dir, gitRepo, branch)
+	return CloneRepo(dir, gitRepo, branch)
 }
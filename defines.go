@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defineName is what a define may be called, a JavaScript identifier.
+var defineName = regexp.MustCompile(`^[A-Za-z_$][\w$]*$`)
+
+// DEFINE_TOKENS are the build values a define's value can use, e.g.
+// "{app_version}+{git_commit}".
+var DEFINE_TOKENS = []string{"name", "id", "version", "app_version", "profile", "git_commit", "build_time"}
+
+// resolveDefines fills in the {tokens} of an app's defines, leaving the final
+// values in config.Defines. Git and the clock are only asked when a define
+// uses them.
+func resolveDefines(opts BuildOptions, config *Config) error {
+	if len(config.Defines) == 0 {
+		return nil
+	}
+
+	cache := map[string]string{}
+	value := func(key string) (string, error) {
+		if v, ok := cache[key]; ok {
+			return v, nil
+		}
+		v, err := buildValue(opts, config, key)
+		cache[key] = v
+		return v, err
+	}
+
+	resolved := make(map[string]string, len(config.Defines))
+	for name, template := range config.Defines {
+		if !defineName.MatchString(name) {
+			return fmt.Errorf("define %q isn't a valid identifier", name)
+		}
+
+		var errs []string
+		resolved[name] = templateToken.ReplaceAllStringFunc(template, func(token string) string {
+			v, err := value(strings.Trim(token, "{}"))
+			if err != nil {
+				errs = append(errs, err.Error())
+			}
+			return v
+		})
+		if len(errs) > 0 {
+			return fmt.Errorf("define %s: %s", name, strings.Join(errs, ", "))
+		}
+	}
+
+	config.Defines = resolved
+	return nil
+}
+
+// buildValue is the value of one {token} a define can use.
+func buildValue(opts BuildOptions, config *Config, key string) (string, error) {
+	switch key {
+	case "name":
+		return config.Data.Name, nil
+	case "id":
+		return config.Data.ID, nil
+	case "version":
+		return strconv.Itoa(config.Data.Version), nil
+	case "app_version":
+		return config.AppVersion, nil
+	case "profile":
+		return opts.Profile, nil
+	case "git_commit":
+		commit, err := headCommit(config.Dir)
+		if err != nil {
+			return "", err
+		}
+		return commit.Hash.String(), nil
+	case "build_time":
+		t, err := buildTime(opts, config)
+		if err != nil {
+			return "", err
+		}
+		return t.UTC().Format(time.RFC3339), nil
+	}
+	return "", fmt.Errorf("unknown {%s}, use {%s}", key, strings.Join(DEFINE_TOKENS, "}, {"))
+}
+
+// buildTime is when the build happened. SOURCE_DATE_EPOCH wins, as it does for
+// other tools, and reproducible builds use the time of the HEAD commit.
+func buildTime(opts BuildOptions, config *Config) (time.Time, error) {
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+		secs, err := strconv.ParseInt(epoch, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("SOURCE_DATE_EPOCH %q isn't a number of seconds", epoch)
+		}
+		return time.Unix(secs, 0), nil
+	}
+
+	if opts.Reproducible {
+		commit, err := headCommit(config.Dir)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("{build_time} in a reproducible build needs SOURCE_DATE_EPOCH or a git commit: %w", err)
+		}
+		return commit.Committer.When, nil
+	}
+
+	if opts.Started.IsZero() {
+		return time.Now(), nil
+	}
+	return opts.Started, nil
+}
+
+// substituteDefines swaps every define used as an identifier in a bundled
+// script for its value, as a string literal. Strings, regular expressions,
+// comments and property names are left alone, so "__VERSION__" or
+// obj.__VERSION__ don't turn into broken code, and a shorthand property
+// { __VERSION__ } is spelled out. Values are never substituted into again.
+func substituteDefines(script []byte, defines map[string]string) []byte {
+	var out bytes.Buffer
+	n := len(script)
+
+	// copyUntil copies script[i:] up to and including end, skipping escapes.
+	copyUntil := func(i int, end string) int {
+		j := i
+		for j < n && !bytes.HasPrefix(script[j:], []byte(end)) {
+			if script[j] == '\\' && end != "*/" && end != "\n" {
+				j++
+			}
+			j++
+		}
+		j = min(j+len(end), n)
+		out.Write(script[i:j])
+		return j
+	}
+
+	// next is the first byte of code from i on, past spaces and comments.
+	next := func(i int) byte {
+		for i < n {
+			switch {
+			case isSpaceByte(script[i]):
+				i++
+			case bytes.HasPrefix(script[i:], []byte("//")):
+				for i < n && script[i] != '\n' {
+					i++
+				}
+			case bytes.HasPrefix(script[i:], []byte("/*")):
+				end := bytes.Index(script[i+2:], []byte("*/"))
+				if end < 0 {
+					return 0
+				}
+				i += end + 4
+			default:
+				return script[i]
+			}
+		}
+		return 0
+	}
+
+	var open []byte // brackets open in code, '$' for the ${ of a template string
+	var last byte   // last byte of the previous token, 0 at the start
+	var word string // the previous token when it was a word
+	inTemplate := false
+
+	for i := 0; i < n; {
+		c := script[i]
+		after := byte(0)
+		if i+1 < n {
+			after = script[i+1]
+		}
+
+		if inTemplate {
+			switch {
+			case c == '\\':
+				out.Write(script[i:min(i+2, n)])
+				i += 2
+				continue
+			case c == '`':
+				inTemplate = false
+				last, word = '`', ""
+			case c == '$' && after == '{':
+				open = append(open, '$')
+				inTemplate = false
+				last, word = '{', ""
+				out.WriteString("${")
+				i += 2
+				continue
+			}
+			out.WriteByte(c)
+			i++
+			continue
+		}
+
+		switch {
+		case isSpaceByte(c):
+			out.WriteByte(c)
+			i++
+			continue
+		case c == '/' && after == '/':
+			i = copyUntil(i, "\n")
+			continue
+		case c == '/' && after == '*':
+			i = copyUntil(i, "*/")
+			continue
+		case c == '/' && regexAllowed(last, word):
+			i = copyRegex(&out, script, i)
+			last, word = ')', "" // a value, so a / after it divides
+			continue
+		case c == '"' || c == '\'':
+			out.WriteByte(c)
+			i = copyUntil(i+1, string(c))
+		case c == '`':
+			out.WriteByte(c)
+			inTemplate = true
+			i++
+		case c == '{' || c == '(' || c == '[':
+			open = append(open, c)
+			out.WriteByte(c)
+			i++
+		case c == '}' || c == ')' || c == ']':
+			if len(open) > 0 {
+				inTemplate = open[len(open)-1] == '$'
+				open = open[:len(open)-1]
+			}
+			out.WriteByte(c)
+			i++
+		case isIdentByte(c):
+			end := i
+			for end < n && isIdentByte(script[end]) {
+				end++
+			}
+			name := string(script[i:end])
+			value, ok := defines[name]
+
+			// In an object literal, right after { or a comma
+			inObject := len(open) > 0 && open[len(open)-1] == '{' && (last == '{' || last == ',')
+			following := next(end)
+			switch {
+			case !ok || last == '.' || c >= '0' && c <= '9':
+				out.WriteString(name)
+			case inObject && following == ':':
+				out.WriteString(name) // a property name
+			case inObject && (following == ',' || following == '}'):
+				literal, _ := json.Marshal(value)
+				fmt.Fprintf(&out, "%s: %s", name, literal)
+			default:
+				literal, _ := json.Marshal(value)
+				out.Write(literal)
+			}
+			i = end
+			last, word = script[end-1], name
+			continue
+		default:
+			out.WriteByte(c)
+			i++
+		}
+		last, word = script[i-1], ""
+	}
+	return out.Bytes()
+}
+
+// regexAllowed tells if a / after the token ending in last starts a regular
+// expression rather than being a division.
+func regexAllowed(last byte, word string) bool {
+	if word != "" {
+		switch word {
+		case "return", "typeof", "instanceof", "in", "of", "new", "delete", "void",
+			"throw", "case", "do", "else", "yield", "await":
+			return true
+		}
+		return false
+	}
+	switch last {
+	case ')', ']', '"', '\'', '`':
+		return false
+	}
+	return true
+}
+
+// copyRegex copies the regular expression literal at script[i] with its
+// flags, and returns where it ends. A / inside [...] doesn't end it.
+func copyRegex(out *bytes.Buffer, script []byte, i int) int {
+	j := i + 1
+	inClass := false
+	for j < len(script) && script[j] != '\n' {
+		c := script[j]
+		if c == '\\' {
+			j += 2
+			continue
+		}
+		if c == '[' {
+			inClass = true
+		} else if c == ']' {
+			inClass = false
+		} else if c == '/' && !inClass {
+			j++
+			break
+		}
+		j++
+	}
+	for j < len(script) && isIdentByte(script[j]) {
+		j++
+	}
+	j = min(j, len(script))
+	out.Write(script[i:j])
+	return j
+}
+
+func isSpaceByte(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// writeBuildInfo writes the defines as an ES module the script can import,
+// at build_info in the app. The file is left alone when nothing changed, so
+// rollup's watch mode doesn't rebuild for nothing.
+func writeBuildInfo(config *Config) error {
+	var out bytes.Buffer
+	names := sortedKeys(config.Defines)
+
+	out.WriteString("// Generated by hyp from the defines in the project config, don't edit.\n")
+	for _, name := range names {
+		literal, _ := json.Marshal(config.Defines[name])
+		fmt.Fprintf(&out, "export const %s = %s;\n", name, literal)
+	}
+	fmt.Fprintf(&out, "export default { %s };\n", strings.Join(names, ", "))
+
+	path := config.resolvePath(config.BuildInfo)
+	if current, err := os.ReadFile(path); err == nil && bytes.Equal(current, out.Bytes()) {
+		return nil
+	}
+	return os.WriteFile(path, out.Bytes(), 0666)
+}
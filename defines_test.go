@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestSubstituteDefines(t *testing.T) {
+	defines := map[string]string{"__V__": "1.2"}
+
+	cases := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"identifier", `log(__V__)`, `log("1.2")`},
+		{"longer identifier", `log(__V__X, X__V__)`, `log(__V__X, X__V__)`},
+		{"double quoted string", `log("__V__")`, `log("__V__")`},
+		{"single quoted string", `log('__V__ \' __V__')`, `log('__V__ \' __V__')`},
+		{"template string", "log(`__V__`)", "log(`__V__`)"},
+		{"template expression", "log(`v${__V__}`)", "log(`v${\"1.2\"}`)"},
+		{"object in template expression", "log(`${ {a: __V__}.a }`)", "log(`${ {a: \"1.2\"}.a }`)"},
+		{"line comment", "// __V__\nlog(__V__)", "// __V__\nlog(\"1.2\")"},
+		{"block comment", `/* __V__ */ log(__V__)`, `/* __V__ */ log("1.2")`},
+		{"member", `log(obj.__V__, obj?.__V__)`, `log(obj.__V__, obj?.__V__)`},
+		{"property name", `x = { __V__: 1, a: __V__ }`, `x = { __V__: 1, a: "1.2" }`},
+		{"shorthand property", `x = { __V__ }`, `x = { __V__: "1.2" }`},
+		{"shorthand among others", `x = { a, __V__, b }`, `x = { a, __V__: "1.2", b }`},
+		{"array", `x = [a, __V__, b]`, `x = [a, "1.2", b]`},
+		{"ternary", `x = a ? __V__ : b`, `x = a ? "1.2" : b`},
+		{"regex with backtick", "const r = /`/g; h(__V__); const t = `__V__`", "const r = /`/g; h(\"1.2\"); const t = `__V__`"},
+		{"regex with quote", `const r = /'/; h(__V__)`, `const r = /'/; h("1.2")`},
+		{"regex with class", `const r = /[/]__V__/; h(__V__)`, `const r = /[/]__V__/; h("1.2")`},
+		{"regex after return", `return /__V__/.test(__V__)`, `return /__V__/.test("1.2")`},
+		{"division", `x = a / __V__ / 2`, `x = a / "1.2" / 2`},
+		{"division after call", `x = f(1) / __V__`, `x = f(1) / "1.2"`},
+		{"division by regex result", `x = /a/g / __V__`, `x = /a/g / "1.2"`},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := string(substituteDefines([]byte(c.in), defines)); got != c.want {
+				t.Errorf("\n got %s\nwant %s", got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// FileFormat is what an asset turned out to be after looking at its bytes.
+type FileFormat struct {
+	Name string
+	Kind string // the prop kind used when none is given
+	Ext  string
+	Mime string
+}
+
+var (
+	formatGLB  = FileFormat{Name: "glb", Kind: "model", Ext: ".glb", Mime: "model/gltf-binary"}
+	formatVRM  = FileFormat{Name: "vrm", Kind: "avatar", Ext: ".vrm", Mime: "application/octet-stream"}
+	formatPNG  = FileFormat{Name: "png", Kind: "texture", Ext: ".png", Mime: "image/png"}
+	formatJPEG = FileFormat{Name: "jpeg", Kind: "texture", Ext: ".jpg", Mime: "image/jpeg"}
+	formatWebP = FileFormat{Name: "webp", Kind: "texture", Ext: ".webp", Mime: "image/webp"}
+	formatKTX2 = FileFormat{Name: "ktx2", Kind: "texture", Ext: ".ktx2", Mime: "image/ktx2"}
+	formatHDR  = FileFormat{Name: "hdr", Kind: "hdr", Ext: ".hdr", Mime: "image/vnd.radiance"}
+	formatMP3  = FileFormat{Name: "mp3", Kind: "audio", Ext: ".mp3", Mime: "audio/mpeg"}
+	formatOGG  = FileFormat{Name: "ogg", Kind: "audio", Ext: ".ogg", Mime: "audio/ogg"}
+	formatWAV  = FileFormat{Name: "wav", Kind: "audio", Ext: ".wav", Mime: "audio/wav"}
+	formatMP4  = FileFormat{Name: "mp4", Kind: "video", Ext: ".mp4", Mime: "video/mp4"}
+)
+
+// kindFormats lists the formats Hyperfy accepts for every kind of asset.
+var kindFormats = map[string][]FileFormat{
+	"texture": {formatPNG, formatJPEG, formatWebP, formatKTX2},
+	"hdr":     {formatHDR},
+	"audio":   {formatMP3, formatOGG, formatWAV},
+	"video":   {formatMP4},
+	"model":   {formatGLB},
+	"emote":   {formatGLB},
+	"avatar":  {formatVRM},
+}
+
+var ktx2Magic = []byte("\xabKTX 20\xbb\r\n\x1a\n")
+
+// detectFormat identifies a file by its magic bytes.
+func detectFormat(data []byte) (FileFormat, bool) {
+	switch {
+	case bytes.HasPrefix(data, []byte("glTF")):
+		if isVRM(data) {
+			return formatVRM, true
+		}
+		return formatGLB, true
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return formatPNG, true
+	case bytes.HasPrefix(data, []byte("\xff\xd8\xff")):
+		return formatJPEG, true
+	case len(data) >= 12 && bytes.HasPrefix(data, []byte("RIFF")) && string(data[8:12]) == "WEBP":
+		return formatWebP, true
+	case len(data) >= 12 && bytes.HasPrefix(data, []byte("RIFF")) && string(data[8:12]) == "WAVE":
+		return formatWAV, true
+	case bytes.HasPrefix(data, ktx2Magic):
+		return formatKTX2, true
+	case bytes.HasPrefix(data, []byte("#?RADIANCE")), bytes.HasPrefix(data, []byte("#?RGBE")):
+		return formatHDR, true
+	case bytes.HasPrefix(data, []byte("OggS")):
+		return formatOGG, true
+	case bytes.HasPrefix(data, []byte("ID3")), len(data) >= 2 && data[0] == 0xff && data[1]&0xe0 == 0xe0:
+		return formatMP3, true
+	case len(data) >= 8 && string(data[4:8]) == "ftyp":
+		return formatMP4, true
+	}
+
+	return FileFormat{}, false
+}
+
+// isVRM checks the JSON chunk of a glTF binary for the VRM extensions.
+func isVRM(data []byte) bool {
+	_, jsonChunk, _, err := readGLBChunks(data)
+	if err != nil {
+		return false
+	}
+
+	var doc GLTF
+	if err := json.Unmarshal(jsonChunk, &doc); err != nil {
+		return false
+	}
+	return hasVRMExtension(doc.ExtensionsUsed, doc.Extensions)
+}
+
+// assetFormat detects the format of an asset and checks it suits the asset's kind.
+func assetFormat(kind string, data []byte) (FileFormat, error) {
+	accepted, ok := kindFormats[kind]
+	if !ok {
+		return FileFormat{}, fmt.Errorf("unsupported asset type %q", kind)
+	}
+
+	format, ok := detectFormat(data)
+	if !ok {
+		return FileFormat{}, fmt.Errorf("unrecognised file format for %s asset", kind)
+	}
+
+	// VRMs are glTF binaries too, so they can be loaded as plain models
+	if format == formatVRM && (kind == "model" || kind == "emote") {
+		format = formatGLB
+	}
+
+	for _, f := range accepted {
+		if f == format {
+			return format, nil
+		}
+	}
+
+	return FileFormat{}, fmt.Errorf("%s files can't be used as %s", format.Name, kind)
+}
+
+// inferKind picks the kind for a file prop that doesn't set one.
+func inferKind(path string, data []byte) (string, error) {
+	format, ok := detectFormat(data)
+	if !ok {
+		return "", fmt.Errorf("can't tell what kind of file %s is, set \"kind\" on the prop", path)
+	}
+	return format.Kind, nil
+}
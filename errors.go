@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Exit codes, so scripts and CI can tell failures apart.
+const (
+	EXIT_ERROR        = 1
+	EXIT_CONFIG_ERROR = 2
+	EXIT_SCRIPT_ERROR = 3
+	EXIT_ASSET_ERROR  = 4
+)
+
+type ErrorKind int
+
+const (
+	ErrGeneral ErrorKind = iota
+	ErrConfig
+	ErrScript
+	ErrAsset
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrConfig:
+		return "config error"
+	case ErrScript:
+		return "script build failed"
+	case ErrAsset:
+		return "asset error"
+	}
+	return "error"
+}
+
+func (k ErrorKind) ExitCode() int {
+	switch k {
+	case ErrConfig:
+		return EXIT_CONFIG_ERROR
+	case ErrScript:
+		return EXIT_SCRIPT_ERROR
+	case ErrAsset:
+		return EXIT_ASSET_ERROR
+	}
+	return EXIT_ERROR
+}
+
+// BuildError is a failure with enough context to find what caused it.
+type BuildError struct {
+	Kind ErrorKind
+	App  string // app being built
+	Path string // file being read
+	Key  string // prop key
+	Err  error
+}
+
+func (e *BuildError) Error() string {
+	var parts []string
+	if e.App != "" {
+		parts = append(parts, "app "+e.App)
+	}
+	if e.Key != "" {
+		parts = append(parts, "prop "+e.Key)
+	}
+	if e.Path != "" {
+		parts = append(parts, e.Path)
+	}
+	parts = append(parts, e.Err.Error())
+	return strings.Join(parts, ": ")
+}
+
+func (e *BuildError) Unwrap() error {
+	return e.Err
+}
+
+func configError(path string, err error) error {
+	return &BuildError{Kind: ErrConfig, Path: path, Err: err}
+}
+
+func assetError(path string, err error) error {
+	return &BuildError{Kind: ErrAsset, Path: path, Err: err}
+}
+
+func propError(key string, path string, err error) error {
+	return &BuildError{Kind: ErrAsset, Key: key, Path: path, Err: err}
+}
+
+// withApp tags every error in err with the app it happened in.
+func withApp(app string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var errs []error
+	for _, e := range flattenErrors(err) {
+		var be *BuildError
+		if errors.As(e, &be) {
+			if be.App == "" {
+				be.App = app
+			}
+			errs = append(errs, e)
+			continue
+		}
+		errs = append(errs, &BuildError{Kind: ErrGeneral, App: app, Err: e})
+	}
+	return errors.Join(errs...)
+}
+
+// flattenErrors unpacks errors.Join so every failure is reported on its own.
+func flattenErrors(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var errs []error
+		for _, e := range joined.Unwrap() {
+			errs = append(errs, flattenErrors(e)...)
+		}
+		return errs
+	}
+	return []error{err}
+}
+
+// reportError prints a readable summary of what went wrong and exits with the
+// code of the first failure.
+func reportError(err error) {
+	errs := flattenErrors(err)
+	code := EXIT_ERROR
+
+	fmt.Fprintf(os.Stderr, "\n❌ %d problem(s):\n", len(errs))
+	for i, e := range errs {
+		var be *BuildError
+		if !errors.As(e, &be) {
+			fmt.Fprintf(os.Stderr, "  - %v\n", e)
+			continue
+		}
+
+		if i == 0 {
+			code = be.Kind.ExitCode()
+		}
+
+		fmt.Fprintf(os.Stderr, "  - %s\n", be.Kind)
+		if be.App != "" {
+			fmt.Fprintf(os.Stderr, "      app:  %s\n", be.App)
+		}
+		if be.Key != "" {
+			fmt.Fprintf(os.Stderr, "      prop: %s\n", be.Key)
+		}
+		if be.Path != "" {
+			fmt.Fprintf(os.Stderr, "      file: %s\n", be.Path)
+		}
+		fmt.Fprintf(os.Stderr, "      %v\n", be.Err)
+	}
+
+	os.Exit(code)
+}
@@ -3,13 +3,15 @@ package main
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
 )
 
-func CloneRepo(path string, url string, branch string) {
+func CloneRepo(path string, url string, branch string) error {
 	branchRef := plumbing.NewBranchReferenceName(branch)
 	fmt.Println("🔄 Cloning or updating repository into:", path)
 
@@ -23,14 +25,12 @@ func CloneRepo(path string, url string, branch string) {
 			Progress:      os.Stdout,
 		})
 		if err != nil {
-			fmt.Println("Error cloning repository:", err)
-			panic(err)
+			return fmt.Errorf("cloning repository %s: %w", url, err)
 		}
 		fmt.Println("Repository cloned successfully into", path)
-		return
+		return nil
 	} else if err != nil {
-		fmt.Println("Error opening repository:", err)
-		panic(err)
+		return fmt.Errorf("opening repository in %s: %w", path, err)
 	}
 
 	// If the repo exists, ensure the remote "origin" is set up.
@@ -42,8 +42,7 @@ func CloneRepo(path string, url string, branch string) {
 			URLs: []string{url},
 		})
 		if err != nil {
-			fmt.Println("Error creating remote:", err)
-			panic(err)
+			return fmt.Errorf("creating remote in %s: %w", path, err)
 		}
 	} else {
 		// Optionally, update remote URL if necessary.
@@ -53,8 +52,7 @@ func CloneRepo(path string, url string, branch string) {
 	// Get the worktree to work with files.
 	w, err := repo.Worktree()
 	if err != nil {
-		fmt.Println("Error getting worktree:", err)
-		panic(err)
+		return fmt.Errorf("getting worktree in %s: %w", path, err)
 	}
 
 	// Attempt to check out the desired branch.
@@ -68,8 +66,7 @@ func CloneRepo(path string, url string, branch string) {
 			Create: true,
 		})
 		if err != nil {
-			fmt.Println("Error checking out branch:", err)
-			panic(err)
+			return fmt.Errorf("checking out branch in %s: %w", path, err)
 		}
 	}
 
@@ -81,9 +78,88 @@ func CloneRepo(path string, url string, branch string) {
 		Progress:      os.Stdout,
 	})
 	if err != nil && err != git.NoErrAlreadyUpToDate {
-		fmt.Println("Error pulling repository:", err)
-		panic(err)
+		return fmt.Errorf("pulling repository in %s: %w", path, err)
 	}
 
 	fmt.Println("Repository updated successfully on branch", branch)
+	return nil
+}
+
+// changedFiles lists the files that changed between ref and HEAD in the repo
+// holding dir, plus anything modified or untracked in the worktree. Paths are
+// absolute so they can be compared with app directories.
+func changedFiles(dir string, ref string) ([]string, error) {
+	repo, err := git.PlainOpenWithOptions(dir, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return nil, fmt.Errorf("opening repository in %s: %w", dir, err)
+	}
+
+	w, err := repo.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("getting worktree in %s: %w", dir, err)
+	}
+	root := w.Filesystem.Root()
+
+	from, err := revisionTree(repo, ref)
+	if err != nil {
+		return nil, err
+	}
+	to, err := revisionTree(repo, "HEAD")
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := object.DiffTree(from, to)
+	if err != nil {
+		return nil, fmt.Errorf("diffing %s against HEAD: %w", ref, err)
+	}
+
+	var files []string
+	for _, change := range changes {
+		// Renames show up on both sides
+		for _, name := range []string{change.From.Name, change.To.Name} {
+			if name != "" {
+				files = append(files, filepath.Join(root, filepath.FromSlash(name)))
+			}
+		}
+	}
+
+	status, err := w.Status()
+	if err != nil {
+		return nil, fmt.Errorf("getting status of %s: %w", root, err)
+	}
+	for name, file := range status {
+		if file.Staging != git.Unmodified || file.Worktree != git.Unmodified {
+			files = append(files, filepath.Join(root, filepath.FromSlash(name)))
+		}
+	}
+
+	return files, nil
+}
+
+func revisionTree(repo *git.Repository, rev string) (*object.Tree, error) {
+	hash, err := repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, fmt.Errorf("resolving %s: %w", rev, err)
+	}
+
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		return nil, fmt.Errorf("reading commit %s: %w", rev, err)
+	}
+	return commit.Tree()
+}
+
+// headCommit is the commit checked out in the repository holding dir.
+func headCommit(dir string) (*object.Commit, error) {
+	repo, err := git.PlainOpenWithOptions(dir, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return nil, fmt.Errorf("opening repository in %s: %w", dir, err)
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return nil, fmt.Errorf("resolving HEAD in %s: %w", dir, err)
+	}
+	return repo.CommitObject(head.Hash())
 }
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/bits"
+)
+
+// ==================== DATA STRUCTURES ====================
+
+const (
+	glbHeaderSize = 12
+	glbChunkJSON  = 0x4E4F534A // "JSON"
+	glbChunkBIN   = 0x004E4942 // "BIN\0"
+)
+
+// GLB is a parsed glTF binary container.
+type GLB struct {
+	Version uint32
+	JSON    []byte
+	BIN     []byte
+	Doc     GLTF
+}
+
+// GLTF holds the parts of the glTF JSON the build looks at.
+type GLTF struct {
+	ExtensionsUsed []string                   `json:"extensionsUsed"`
+	Extensions     map[string]json.RawMessage `json:"extensions"`
+	Buffers        []GLTFBuffer               `json:"buffers"`
+	BufferViews    []GLTFBufferView           `json:"bufferViews"`
+	Accessors      []GLTFAccessor             `json:"accessors"`
+	Meshes         []GLTFMesh                 `json:"meshes"`
+	Materials      []json.RawMessage          `json:"materials"`
+	Textures       []GLTFTexture              `json:"textures"`
+	Images         []GLTFImage                `json:"images"`
+	Nodes          []json.RawMessage          `json:"nodes"`
+}
+
+type GLTFBuffer struct {
+	ByteLength int    `json:"byteLength"`
+	URI        string `json:"uri,omitempty"`
+}
+
+type GLTFBufferView struct {
+	Buffer     int `json:"buffer"`
+	ByteOffset int `json:"byteOffset"`
+	ByteLength int `json:"byteLength"`
+	ByteStride int `json:"byteStride"`
+}
+
+type GLTFAccessor struct {
+	BufferView    *int   `json:"bufferView"`
+	ByteOffset    int    `json:"byteOffset"`
+	ComponentType int    `json:"componentType"`
+	Count         int    `json:"count"`
+	Type          string `json:"type"`
+}
+
+type GLTFMesh struct {
+	Primitives []GLTFPrimitive `json:"primitives"`
+}
+
+type GLTFPrimitive struct {
+	Attributes map[string]int `json:"attributes"`
+	Indices    *int           `json:"indices"`
+	Material   *int           `json:"material"`
+	Mode       *int           `json:"mode"`
+}
+
+type GLTFTexture struct {
+	Source *int `json:"source"`
+}
+
+type GLTFImage struct {
+	BufferView *int   `json:"bufferView"`
+	MimeType   string `json:"mimeType"`
+	URI        string `json:"uri"`
+}
+
+// ModelStats are the numbers reported for every model in the build output.
+type ModelStats struct {
+	Meshes    int `json:"meshes"`
+	Materials int `json:"materials"`
+	Textures  int `json:"textures"`
+	Triangles int `json:"triangles"`
+
+	// TextureSize is the largest width or height of the embedded images.
+	TextureSize int `json:"texture_size"`
+}
+
+func (s ModelStats) String() string {
+	return fmt.Sprintf("%d meshes, %d materials, %d textures (largest %dpx), %d triangles",
+		s.Meshes, s.Materials, s.Textures, s.TextureSize, s.Triangles)
+}
+
+var componentSizes = map[int]int{
+	5120: 1, // BYTE
+	5121: 1, // UNSIGNED_BYTE
+	5122: 2, // SHORT
+	5123: 2, // UNSIGNED_SHORT
+	5125: 4, // UNSIGNED_INT
+	5126: 4, // FLOAT
+}
+
+var typeComponents = map[string]int{
+	"SCALAR": 1,
+	"VEC2":   2,
+	"VEC3":   3,
+	"VEC4":   4,
+	"MAT2":   4,
+	"MAT3":   9,
+	"MAT4":   16,
+}
+
+// ==================== PARSING ====================
+
+// readGLBChunks splits a glTF binary into its JSON and BIN chunks.
+func readGLBChunks(data []byte) (version uint32, jsonChunk []byte, binChunk []byte, err error) {
+	if len(data) < glbHeaderSize || string(data[0:4]) != "glTF" {
+		return 0, nil, nil, errors.New("not a glTF binary (bad magic)")
+	}
+
+	version = binary.LittleEndian.Uint32(data[4:8])
+	if version != 2 {
+		return 0, nil, nil, fmt.Errorf("unsupported glTF version %d", version)
+	}
+
+	length := binary.LittleEndian.Uint32(data[8:12])
+	if uint64(length) != uint64(len(data)) {
+		return 0, nil, nil, fmt.Errorf("header says %d bytes but the file has %d", length, len(data))
+	}
+
+	pos := uint64(glbHeaderSize)
+	for index := 0; pos < uint64(len(data)); index++ {
+		if pos+8 > uint64(len(data)) {
+			return 0, nil, nil, fmt.Errorf("truncated chunk header at byte %d", pos)
+		}
+
+		chunkLen := uint64(binary.LittleEndian.Uint32(data[pos : pos+4]))
+		chunkType := binary.LittleEndian.Uint32(data[pos+4 : pos+8])
+		pos += 8
+
+		if pos+chunkLen > uint64(len(data)) {
+			return 0, nil, nil, fmt.Errorf("chunk %d runs past the end of the file", index)
+		}
+		chunk := data[pos : pos+chunkLen]
+		pos += chunkLen
+
+		switch {
+		case index == 0 && chunkType != glbChunkJSON:
+			return 0, nil, nil, errors.New("first chunk is not JSON")
+		case index == 0:
+			jsonChunk = chunk
+		case index == 1 && chunkType == glbChunkBIN:
+			binChunk = chunk
+		}
+		// Any other chunk is an extension chunk and gets ignored, as the spec says.
+	}
+
+	if jsonChunk == nil {
+		return 0, nil, nil, errors.New("missing JSON chunk")
+	}
+	return version, jsonChunk, binChunk, nil
+}
+
+// parseGLB reads a glTF binary and checks every buffer view and accessor fits
+// inside the data it points at.
+func parseGLB(data []byte) (*GLB, error) {
+	version, jsonChunk, binChunk, err := readGLBChunks(data)
+	if err != nil {
+		return nil, err
+	}
+
+	glb := &GLB{Version: version, JSON: jsonChunk, BIN: binChunk}
+	if err := json.Unmarshal(jsonChunk, &glb.Doc); err != nil {
+		return nil, fmt.Errorf("invalid glTF JSON: %w", err)
+	}
+
+	if err := glb.validate(); err != nil {
+		return nil, err
+	}
+	return glb, nil
+}
+
+func (g *GLB) validate() error {
+	doc := &g.Doc
+
+	for i, buffer := range doc.Buffers {
+		if buffer.URI != "" {
+			return fmt.Errorf("buffer %d points at an external file, only self-contained GLBs can be bundled", i)
+		}
+		if i > 0 {
+			return fmt.Errorf("buffer %d has no uri, only buffer 0 can use the BIN chunk", i)
+		}
+		if buffer.ByteLength > len(g.BIN) {
+			return fmt.Errorf("buffer %d wants %d bytes but the BIN chunk has %d", i, buffer.ByteLength, len(g.BIN))
+		}
+	}
+
+	for i, view := range doc.BufferViews {
+		if view.Buffer < 0 || view.Buffer >= len(doc.Buffers) {
+			return fmt.Errorf("bufferView %d references missing buffer %d", i, view.Buffer)
+		}
+		if _, ok := byteRange(view.ByteOffset, view.ByteLength, doc.Buffers[view.Buffer].ByteLength); !ok {
+			return fmt.Errorf("bufferView %d (offset %d, length %d) is out of range of buffer %d", i, view.ByteOffset, view.ByteLength, view.Buffer)
+		}
+		if view.ByteStride < 0 {
+			return fmt.Errorf("bufferView %d has a negative byteStride", i)
+		}
+	}
+
+	for i, accessor := range doc.Accessors {
+		compSize, ok := componentSizes[accessor.ComponentType]
+		if !ok {
+			return fmt.Errorf("accessor %d has unknown componentType %d", i, accessor.ComponentType)
+		}
+		components, ok := typeComponents[accessor.Type]
+		if !ok {
+			return fmt.Errorf("accessor %d has unknown type %q", i, accessor.Type)
+		}
+
+		// Accessors without a buffer view are all zeros (or sparse only)
+		if accessor.BufferView == nil || accessor.Count == 0 {
+			continue
+		}
+		if *accessor.BufferView < 0 || *accessor.BufferView >= len(doc.BufferViews) {
+			return fmt.Errorf("accessor %d references missing bufferView %d", i, *accessor.BufferView)
+		}
+
+		view := doc.BufferViews[*accessor.BufferView]
+		elemSize := compSize * components
+		stride := view.ByteStride
+		if stride == 0 {
+			stride = elemSize
+		}
+
+		if accessor.Count < 0 {
+			return fmt.Errorf("accessor %d has a negative count", i)
+		}
+		// stride*(count-1)+elemSize, in uint64 so a huge count can't wrap around
+		hi, span := bits.Mul64(uint64(stride), uint64(accessor.Count-1))
+		span += uint64(elemSize)
+		if hi != 0 || span < uint64(elemSize) || span > uint64(maxInt) {
+			return fmt.Errorf("accessor %d needs more bytes than bufferView %d has (%d)", i, *accessor.BufferView, view.ByteLength)
+		}
+		if _, ok := byteRange(accessor.ByteOffset, int(span), view.ByteLength); !ok {
+			return fmt.Errorf("accessor %d needs %d bytes at offset %d but bufferView %d has %d", i, span, accessor.ByteOffset, *accessor.BufferView, view.ByteLength)
+		}
+	}
+
+	for m, mesh := range doc.Meshes {
+		for p, prim := range mesh.Primitives {
+			for name, index := range prim.Attributes {
+				if index < 0 || index >= len(doc.Accessors) {
+					return fmt.Errorf("mesh %d primitive %d attribute %s references missing accessor %d", m, p, name, index)
+				}
+			}
+			if prim.Indices != nil && (*prim.Indices < 0 || *prim.Indices >= len(doc.Accessors)) {
+				return fmt.Errorf("mesh %d primitive %d references missing index accessor %d", m, p, *prim.Indices)
+			}
+			if prim.Material != nil && (*prim.Material < 0 || *prim.Material >= len(doc.Materials)) {
+				return fmt.Errorf("mesh %d primitive %d references missing material %d", m, p, *prim.Material)
+			}
+		}
+	}
+
+	for i, texture := range doc.Textures {
+		if texture.Source != nil && (*texture.Source < 0 || *texture.Source >= len(doc.Images)) {
+			return fmt.Errorf("texture %d references missing image %d", i, *texture.Source)
+		}
+	}
+
+	for i, image := range doc.Images {
+		if image.BufferView != nil && (*image.BufferView < 0 || *image.BufferView >= len(doc.BufferViews)) {
+			return fmt.Errorf("image %d references missing bufferView %d", i, *image.BufferView)
+		}
+	}
+
+	return nil
+}
+
+// IsVRM reports whether the model carries VRM 0.x or 1.0 avatar data.
+func (g *GLB) IsVRM() bool {
+	return hasVRMExtension(g.Doc.ExtensionsUsed, g.Doc.Extensions)
+}
+
+func hasVRMExtension(used []string, extensions map[string]json.RawMessage) bool {
+	for _, ext := range used {
+		if ext == "VRM" || ext == "VRMC_vrm" {
+			return true
+		}
+	}
+	_, vrm0 := extensions["VRM"]
+	_, vrm1 := extensions["VRMC_vrm"]
+	return vrm0 || vrm1
+}
+
+// Stats counts meshes, materials, textures and triangles in the model.
+func (g *GLB) Stats() ModelStats {
+	stats := ModelStats{
+		Meshes:    len(g.Doc.Meshes),
+		Materials: len(g.Doc.Materials),
+		Textures:  len(g.Doc.Textures),
+	}
+
+	for _, image := range g.Doc.Images {
+		if data := g.imageData(image); data != nil {
+			if w, h, ok := imageSize(data); ok {
+				stats.TextureSize = max(stats.TextureSize, w, h)
+			}
+		}
+	}
+
+	for _, mesh := range g.Doc.Meshes {
+		for _, prim := range mesh.Primitives {
+			count := 0
+			if prim.Indices != nil {
+				count = g.Doc.Accessors[*prim.Indices].Count
+			} else if pos, ok := prim.Attributes["POSITION"]; ok {
+				count = g.Doc.Accessors[pos].Count
+			}
+
+			mode := 4 // TRIANGLES
+			if prim.Mode != nil {
+				mode = *prim.Mode
+			}
+
+			switch mode {
+			case 4:
+				stats.Triangles += count / 3
+			case 5, 6: // TRIANGLE_STRIP, TRIANGLE_FAN
+				if count > 2 {
+					stats.Triangles += count - 2
+				}
+			}
+		}
+	}
+
+	return stats
+}
+
+// imageData returns the bytes of an image embedded through a buffer view.
+func (g *GLB) imageData(image GLTFImage) []byte {
+	if image.BufferView == nil {
+		return nil
+	}
+	return g.viewData(*image.BufferView)
+}
+
+// viewData returns the bytes of a buffer view, or nil when the view or its
+// range doesn't exist in the BIN chunk.
+func (g *GLB) viewData(index int) []byte {
+	if index < 0 || index >= len(g.Doc.BufferViews) {
+		return nil
+	}
+	view := g.Doc.BufferViews[index]
+	end, ok := byteRange(view.ByteOffset, view.ByteLength, len(g.BIN))
+	if !ok {
+		return nil
+	}
+	return g.BIN[view.ByteOffset:end]
+}
+
+const maxInt = int(^uint(0) >> 1)
+
+// byteRange returns the end of length bytes at offset, and whether that range
+// fits in size bytes. The sum is done in uint64 so it can't overflow.
+func byteRange(offset int, length int, size int) (int, bool) {
+	if offset < 0 || length < 0 || size < 0 {
+		return 0, false
+	}
+	end := uint64(offset) + uint64(length)
+	if end > uint64(size) {
+		return 0, false
+	}
+	return int(end), true
+}
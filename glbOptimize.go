@@ -0,0 +1,467 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// gltfKinds are the top level glTF arrays the optimizer can prune and renumber.
+var gltfKinds = []string{
+	"nodes", "meshes", "skins", "cameras", "accessors",
+	"materials", "textures", "images", "samplers", "bufferViews",
+}
+
+// safeExtensions don't hold indices the optimizer would have to renumber.
+var safeExtensions = map[string]bool{
+	"KHR_texture_transform": true,
+	"KHR_mesh_quantization": true,
+	"KHR_lights_punctual":   true,
+	"KHR_texture_basisu":    true,
+	"EXT_texture_webp":      true,
+	"EXT_texture_avif":      true,
+}
+
+// OptimizeReport says what the optimizer removed from a model.
+type OptimizeReport struct {
+	Before  int
+	After   int
+	Removed map[string]int
+}
+
+func (r OptimizeReport) String() string {
+	var removed []string
+	for _, kind := range gltfKinds {
+		if n := r.Removed[kind]; n > 0 {
+			removed = append(removed, fmt.Sprintf("%d %s", n, kind))
+		}
+	}
+	if len(removed) == 0 {
+		removed = append(removed, "nothing")
+	}
+	return fmt.Sprintf("%s -> %s, removed %s", formatBytes(r.Before), formatBytes(r.After), strings.Join(removed, ", "))
+}
+
+// ==================== JSON HELPERS ====================
+
+func gltfList(doc map[string]any, key string) []any {
+	list, _ := doc[key].([]any)
+	return list
+}
+
+func gltfObject(v any) map[string]any {
+	obj, _ := v.(map[string]any)
+	return obj
+}
+
+func gltfIndex(v any) (int, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		i, err := n.Int64()
+		return int(i), err == nil
+	case float64:
+		return int(n), true
+	case int:
+		return n, true
+	}
+	return 0, false
+}
+
+// refVisitor is called for every index one glTF object holds into another array.
+// set replaces the index in place.
+type refVisitor func(kind string, index int, set func(int))
+
+func visitField(obj map[string]any, key string, kind string, fn refVisitor) {
+	if obj == nil {
+		return
+	}
+	if index, ok := gltfIndex(obj[key]); ok {
+		fn(kind, index, func(i int) { obj[key] = i })
+	}
+}
+
+func visitList(list []any, kind string, fn refVisitor) {
+	for i := range list {
+		if index, ok := gltfIndex(list[i]); ok {
+			fn(kind, index, func(n int) { list[i] = n })
+		}
+	}
+}
+
+func visitMap(obj map[string]any, kind string, fn refVisitor) {
+	for key := range obj {
+		visitField(obj, key, kind, fn)
+	}
+}
+
+// visitTextureRefs finds every textureInfo in a material, extensions included.
+func visitTextureRefs(v any, fn refVisitor) {
+	switch value := v.(type) {
+	case map[string]any:
+		for key, child := range value {
+			if info := gltfObject(child); info != nil && strings.HasSuffix(key, "Texture") {
+				visitField(info, "index", "textures", fn)
+			}
+			visitTextureRefs(child, fn)
+		}
+	case []any:
+		for _, child := range value {
+			visitTextureRefs(child, fn)
+		}
+	}
+}
+
+// visitRefs calls fn for every reference held by one item of the given kind.
+func visitRefs(kind string, item map[string]any, fn refVisitor) {
+	switch kind {
+	case "scenes":
+		visitList(gltfList(item, "nodes"), "nodes", fn)
+	case "nodes":
+		visitList(gltfList(item, "children"), "nodes", fn)
+		visitField(item, "mesh", "meshes", fn)
+		visitField(item, "skin", "skins", fn)
+		visitField(item, "camera", "cameras", fn)
+	case "skins":
+		visitList(gltfList(item, "joints"), "nodes", fn)
+		visitField(item, "skeleton", "nodes", fn)
+		visitField(item, "inverseBindMatrices", "accessors", fn)
+	case "animations":
+		for _, channel := range gltfList(item, "channels") {
+			visitField(gltfObject(gltfObject(channel)["target"]), "node", "nodes", fn)
+		}
+		for _, sampler := range gltfList(item, "samplers") {
+			visitField(gltfObject(sampler), "input", "accessors", fn)
+			visitField(gltfObject(sampler), "output", "accessors", fn)
+		}
+	case "meshes":
+		for _, p := range gltfList(item, "primitives") {
+			prim := gltfObject(p)
+			visitMap(gltfObject(prim["attributes"]), "accessors", fn)
+			visitField(prim, "indices", "accessors", fn)
+			visitField(prim, "material", "materials", fn)
+			for _, target := range gltfList(prim, "targets") {
+				visitMap(gltfObject(target), "accessors", fn)
+			}
+		}
+	case "materials":
+		visitTextureRefs(item, fn)
+	case "textures":
+		visitField(item, "source", "images", fn)
+		visitField(item, "sampler", "samplers", fn)
+		for _, ext := range gltfObject(item["extensions"]) {
+			visitField(gltfObject(ext), "source", "images", fn)
+		}
+	case "images":
+		visitField(item, "bufferView", "bufferViews", fn)
+	case "accessors":
+		visitField(item, "bufferView", "bufferViews", fn)
+		sparse := gltfObject(item["sparse"])
+		visitField(gltfObject(sparse["indices"]), "bufferView", "bufferViews", fn)
+		visitField(gltfObject(sparse["values"]), "bufferView", "bufferViews", fn)
+	}
+}
+
+func stripExtras(v any) {
+	switch value := v.(type) {
+	case map[string]any:
+		delete(value, "extras")
+		for _, child := range value {
+			stripExtras(child)
+		}
+	case []any:
+		for _, child := range value {
+			stripExtras(child)
+		}
+	}
+}
+
+// ==================== OPTIMIZER ====================
+
+// optimizeGLB rewrites a glTF binary without the parts nothing uses. Models it
+// can't safely rewrite (VRMs, unknown extensions, external buffers) come back as is.
+func optimizeGLB(data []byte, opts *OptimizeOptions) ([]byte, OptimizeReport, error) {
+	report := OptimizeReport{Before: len(data), After: len(data), Removed: map[string]int{}}
+
+	glb, err := parseGLB(data)
+	if err != nil {
+		return data, report, err
+	}
+	if glb.IsVRM() {
+		return data, report, fmt.Errorf("VRM avatars are left untouched")
+	}
+	for _, ext := range glb.Doc.ExtensionsUsed {
+		if !safeExtensions[ext] && (!strings.HasPrefix(ext, "KHR_materials_") || ext == "KHR_materials_variants") {
+			return data, report, fmt.Errorf("uses extension %s, which the optimizer doesn't understand", ext)
+		}
+	}
+
+	var doc map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(glb.JSON))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return data, report, err
+	}
+
+	viewBytes := glb.viewData
+
+	if opts.StripExtras {
+		stripExtras(doc)
+	}
+
+	merged := map[string]map[int]bool{"bufferViews": {}, "images": {}}
+	if opts.Dedupe {
+		dedupeGLTF(doc, glb, viewBytes, merged)
+	}
+
+	used := markUsed(doc, opts.Prune, merged)
+
+	// Renumber everything that survived, keeping the original order
+	remap := map[string]map[int]int{}
+	for _, kind := range gltfKinds {
+		remap[kind] = map[int]int{}
+		var kept []any
+		for i, item := range gltfList(doc, kind) {
+			if used[kind][i] {
+				remap[kind][i] = len(kept)
+				kept = append(kept, item)
+			} else {
+				report.Removed[kind]++
+			}
+		}
+		if kept != nil {
+			doc[kind] = kept
+		} else {
+			delete(doc, kind)
+		}
+	}
+
+	// Buffer views get packed in the order accessors and images read them
+	order := packOrder(doc, remap["bufferViews"])
+	views := gltfList(doc, "bufferViews")
+	oldViews := make([]int, len(order))
+	packed := make([]any, len(order))
+	for old, kept := range remap["bufferViews"] {
+		oldViews[kept] = old
+	}
+	for kept, position := range order {
+		packed[position] = views[kept]
+	}
+	for old, kept := range remap["bufferViews"] {
+		remap["bufferViews"][old] = order[kept]
+	}
+
+	rewrite := func(kind string, index int, set func(int)) {
+		set(remap[kind][index])
+	}
+	for _, kind := range append([]string{"scenes", "animations"}, gltfKinds...) {
+		for _, item := range gltfList(doc, kind) {
+			visitRefs(kind, gltfObject(item), rewrite)
+		}
+	}
+
+	source := make([]int, len(order))
+	for kept, position := range order {
+		source[position] = oldViews[kept]
+	}
+
+	var bin []byte
+	for position, old := range source {
+		for len(bin)%4 != 0 {
+			bin = append(bin, 0)
+		}
+		view := gltfObject(packed[position])
+		view["buffer"] = 0
+		view["byteOffset"] = len(bin)
+		bin = append(bin, viewBytes(old)...)
+	}
+	if len(packed) > 0 {
+		doc["bufferViews"] = packed
+		buffer := gltfObject(gltfList(doc, "buffers")[0])
+		buffer["byteLength"] = len(bin)
+		doc["buffers"] = []any{buffer}
+	} else {
+		delete(doc, "bufferViews")
+		delete(doc, "buffers")
+	}
+
+	jsonChunk, err := json.Marshal(doc)
+	if err != nil {
+		return data, report, err
+	}
+
+	out := writeGLB(jsonChunk, bin)
+	if _, err := parseGLB(out); err != nil {
+		return data, report, fmt.Errorf("optimized model failed validation: %w", err)
+	}
+
+	report.After = len(out)
+	return out, report, nil
+}
+
+// dedupeGLTF points every reference to a duplicate buffer view or image at the
+// first identical one.
+func dedupeGLTF(doc map[string]any, glb *GLB, viewBytes func(int) []byte, merged map[string]map[int]bool) {
+	canonical := map[string]map[int]int{"bufferViews": {}, "images": {}}
+
+	first := map[string]int{}
+	for i, view := range glb.Doc.BufferViews {
+		target, _ := gltfIndex(gltfObject(gltfList(doc, "bufferViews")[i])["target"])
+		key := fmt.Sprintf("%s/%d/%d", hashBytes(viewBytes(i)), view.ByteStride, target)
+		if j, seen := first[key]; seen {
+			canonical["bufferViews"][i] = j
+			merged["bufferViews"][i] = true
+		} else {
+			first[key] = i
+		}
+	}
+
+	first = map[string]int{}
+	for i, image := range glb.Doc.Images {
+		if image.BufferView == nil {
+			continue
+		}
+		key := image.MimeType + "/" + hashBytes(viewBytes(*image.BufferView))
+		if j, seen := first[key]; seen {
+			canonical["images"][i] = j
+			merged["images"][i] = true
+		} else {
+			first[key] = i
+		}
+	}
+
+	redirect := func(kind string, index int, set func(int)) {
+		if to, ok := canonical[kind][index]; ok {
+			set(to)
+		}
+	}
+	for _, kind := range []string{"accessors", "images", "textures"} {
+		for _, item := range gltfList(doc, kind) {
+			visitRefs(kind, gltfObject(item), redirect)
+		}
+	}
+}
+
+// markUsed finds the items reachable from the scenes and animations. Without
+// pruning everything counts as used, apart from merged duplicates.
+func markUsed(doc map[string]any, prune bool, merged map[string]map[int]bool) map[string]map[int]bool {
+	used := map[string]map[int]bool{}
+	for _, kind := range gltfKinds {
+		used[kind] = map[int]bool{}
+	}
+
+	type item struct {
+		kind  string
+		index int
+	}
+	var queue []item
+
+	mark := func(kind string, index int, _ func(int)) {
+		if index < 0 || index >= len(gltfList(doc, kind)) || used[kind][index] {
+			return
+		}
+		used[kind][index] = true
+		queue = append(queue, item{kind, index})
+	}
+
+	if prune {
+		for _, kind := range []string{"scenes", "animations"} {
+			for _, root := range gltfList(doc, kind) {
+				visitRefs(kind, gltfObject(root), mark)
+			}
+		}
+		// A file without scenes is a library of nodes
+		if len(gltfList(doc, "scenes")) == 0 {
+			for i := range gltfList(doc, "nodes") {
+				mark("nodes", i, nil)
+			}
+		}
+	} else {
+		for _, kind := range gltfKinds {
+			for i := range gltfList(doc, kind) {
+				if !merged[kind][i] {
+					mark(kind, i, nil)
+				}
+			}
+		}
+	}
+
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		visitRefs(next.kind, gltfObject(gltfList(doc, next.kind)[next.index]), mark)
+	}
+
+	return used
+}
+
+// packOrder gives every kept buffer view its position in the new BIN chunk:
+// first come the views accessors read, in accessor order, then image views.
+func packOrder(doc map[string]any, keptViews map[int]int) []int {
+	order := make([]int, len(keptViews))
+	for i := range order {
+		order[i] = -1
+	}
+	next := 0
+
+	place := func(kind string, index int, _ func(int)) {
+		if kind != "bufferViews" {
+			return
+		}
+		if kept, ok := keptViews[index]; ok && order[kept] < 0 {
+			order[kept] = next
+			next++
+		}
+	}
+	for _, kind := range []string{"accessors", "images"} {
+		for _, item := range gltfList(doc, kind) {
+			visitRefs(kind, gltfObject(item), place)
+		}
+	}
+
+	// Views nothing points at (kept when pruning is off) go last
+	var rest []int
+	for kept, position := range order {
+		if position < 0 {
+			rest = append(rest, kept)
+		}
+	}
+	sort.Ints(rest)
+	for _, kept := range rest {
+		order[kept] = next
+		next++
+	}
+
+	return order
+}
+
+// writeGLB assembles a glTF binary, padding both chunks to four bytes.
+func writeGLB(jsonChunk []byte, bin []byte) []byte {
+	for len(jsonChunk)%4 != 0 {
+		jsonChunk = append(jsonChunk, ' ')
+	}
+	for len(bin)%4 != 0 {
+		bin = append(bin, 0)
+	}
+
+	total := glbHeaderSize + 8 + len(jsonChunk)
+	if len(bin) > 0 {
+		total += 8 + len(bin)
+	}
+
+	out := make([]byte, 0, total)
+	out = append(out, "glTF"...)
+	out = binary.LittleEndian.AppendUint32(out, 2)
+	out = binary.LittleEndian.AppendUint32(out, uint32(total))
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(jsonChunk)))
+	out = binary.LittleEndian.AppendUint32(out, glbChunkJSON)
+	out = append(out, jsonChunk...)
+	if len(bin) > 0 {
+		out = binary.LittleEndian.AppendUint32(out, uint32(len(bin)))
+		out = binary.LittleEndian.AppendUint32(out, glbChunkBIN)
+		out = append(out, bin...)
+	}
+	return out
+}
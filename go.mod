@@ -3,8 +3,10 @@ module github.com/Bitmato-Studio/HypTool
 go 1.24.0
 
 require (
+	github.com/BurntSushi/toml v1.4.0
 	github.com/go-git/go-git/v5 v5.14.0
 	github.com/manifoldco/promptui v0.9.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
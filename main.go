@@ -4,13 +4,30 @@ import (
 	"flag"
 	"log"
 	"os"
-	"strings"
+	"time"
 )
 
 const APPROLLUP_FILENAME = "approllup.json"
 const APPROLLUP_MHA_NAME = "approllup.mha.json"
 
+// commands run instead of the flag based actions when named first.
+var commands = map[string]func(args []string) error{
+	"app":    runAppCommand,
+	"config": runConfigCommand,
+	"props":  runPropsCommand,
+	"stats":  runStatsCommand,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			if err := command(os.Args[2:]); err != nil {
+				reportError(err)
+			}
+			return
+		}
+	}
+
 	isInitApp := flag.Bool("init", false, "Create a new app project")
 	isInitMultiApp := flag.Bool("initmha", false, "Create a new app with multiple apps")
 	isBuildApp := flag.Bool("build", false, "Build a App-Rollup")
@@ -26,51 +43,74 @@ func main() {
 	// cloneUrl := flag.String("clone_uri", "localhost:3000", "What uri you want to clone from")
 
 	scriptBuild := flag.Bool("nsb", false, "Turns off npx rollup -c command")
-	isUnpack := flag.Bool("unpack", false, "Run unpack")
+	isUnpack := flag.Bool("unpack", false, "Run unpack on a .hyp or .hyppack")
 	filepath := flag.String("file", "", "The file to manipulate")
 
 	buildHypJson := flag.Bool("bjson", false, "Build App json for debugging")
 	defaultUnique := flag.Bool("dunique", true, "Disable unique by default")
+	reproducible := flag.Bool("reproducible", false, "Fail instead of doing anything that makes builds differ")
+	checkReproducible := flag.Bool("check-reproducible", false, "Build twice and compare the hashes instead of writing")
+	jobs := flag.Int("jobs", 0, "How many apps of a multi-hyp project to build at once (0 for one per CPU)")
+	failFast := flag.Bool("fail-fast", false, "Stop building a multi-hyp project once an app fails")
+	outDir := flag.String("out", "", "Directory to write .hyp files to (overrides out_dir)")
+	pack := flag.Bool("pack", false, "Also bundle the apps of a multi-hyp project into one .hyppack")
+	apps := flag.String("app", "", "Only build these apps of a multi-hyp project (comma separated names, IDs or globs)")
+	changedSince := flag.String("changed", "", "Only build apps of a multi-hyp project that changed since this git ref")
+	reportHTML := flag.Bool("report-html", false, "Also write each build report as HTML next to the .hyp")
+	profile := flag.String("profile", "", "Build with this profile of each app (see profiles in approllup.json)")
+
+	projectPath := projectFlag(flag.CommandLine)
 
 	isSetVersion := flag.Bool("setversion", false, "Run to change the version of your app")
 
 	flag.Parse()
 	if *isInitApp {
-		runCreateApp(false)
+		if err := runCreateApp(false); err != nil {
+			reportError(err)
+		}
 	}
 
 	if *isInitMultiApp {
-		runCreateApp(true)
+		if err := runCreateApp(true); err != nil {
+			reportError(err)
+		}
 	}
 
 	if *isAddApp {
-		createMHASub()
+		if err := createMHASub(*projectPath); err != nil {
+			reportError(err)
+		}
 	}
 
 	if *isBuildApp {
-		dir, err := os.Getwd()
-		if err != nil {
-			panic(err)
-		}
-
-		files, err := os.ReadDir(dir)
-		if err != nil {
-			panic(err)
+		opts := BuildOptions{
+			UniqueDefault:     *defaultUnique,
+			HypJson:           *buildHypJson,
+			NoScriptBuild:     *scriptBuild,
+			Reproducible:      *reproducible || *checkReproducible,
+			CheckReproducible: *checkReproducible,
+			Jobs:              *jobs,
+			FailFast:          *failFast,
+			Pack:              *pack,
+			OutDir:            *outDir,
+			Apps:              splitList(*apps),
+			ChangedSince:      *changedSince,
+			Profile:           *profile,
+			Started:           time.Now(),
+			ReportHTML:        *reportHTML,
 		}
 
-		isMHA := false
-
-		for _, f := range files {
-			if strings.Contains(f.Name(), "mha") {
-				isMHA = true
-				break
+		project, err := openProject(*projectPath)
+		if err == nil {
+			if project.MHA {
+				err = buildMHAProject(opts, project)
+			} else {
+				_, err = buildAppProject(opts, project, nil)
 			}
 		}
 
-		if !isMHA {
-			buildAppProject(*defaultUnique, *buildHypJson, *scriptBuild, nil)
-		} else {
-			buildMHAProject(*defaultUnique, *buildHypJson, *scriptBuild)
+		if err != nil {
+			reportError(err)
 		}
 	}
 
@@ -89,7 +129,9 @@ func main() {
 	}
 
 	if *isUnpack {
-		unpackHyp(*filepath)
+		if err := unpackHyp(*filepath); err != nil {
+			reportError(err)
+		}
 	}
 
 }
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+)
+
+// mhaFile is approllup.mha.json with a defaults block every app inherits from.
+// Each entry in apps only holds what it overrides. The older layout, a bare
+// array of full app configs, is read as apps with no defaults at schema
+// version 0, and saved in this one with a backup of the old file.
+type mhaFile struct {
+	Schema        string           `json:"$schema,omitempty"`
+	SchemaVersion int              `json:"schema_version,omitempty"`
+	Defaults      map[string]any   `json:"defaults,omitempty"`
+	Shared        string           `json:"shared,omitempty"` // directory "shared:" paths point into
+	Apps          []map[string]any `json:"apps"`
+
+	loadedVersion int // schema_version on disk before migrateMHAFile, see backupOldConfig
+}
+
+func parseMHAFile(blob []byte) (*mhaFile, error) {
+	var file mhaFile
+
+	if bytes.HasPrefix(bytes.TrimSpace(blob), []byte("[")) {
+		if err := json.Unmarshal(blob, &file.Apps); err != nil {
+			return nil, err
+		}
+		return &file, nil
+	}
+
+	if err := json.Unmarshal(blob, &file); err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// mergeMaps lays over on top of base, merging nested objects key by key.
+// Neither map is changed.
+func mergeMaps(base map[string]any, over map[string]any) map[string]any {
+	out := make(map[string]any, len(base)+len(over))
+	for k, v := range base {
+		out[k] = v
+	}
+
+	for k, v := range over {
+		if baseObj, ok := out[k].(map[string]any); ok {
+			if overObj, ok := v.(map[string]any); ok {
+				out[k] = mergeMaps(baseObj, overObj)
+				continue
+			}
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// updateMap applies the changes between before and after, an app's config as
+// loaded and as it is now, to raw, the app as written in the file. Keys that
+// didn't change are left alone, so what the app inherits from defaults stays
+// inherited. Values that went back to the default, or to nothing when there's
+// no default, are dropped. Keys the app cleared are written as null, or the
+// default would come back on the next load.
+func updateMap(raw map[string]any, before map[string]any, after map[string]any, defaults map[string]any) {
+	keys := sortedKeys(before)
+	for k := range after {
+		if _, ok := before[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+
+	for _, k := range keys {
+		b, inBefore := before[k]
+		a, inAfter := after[k]
+		if inBefore && inAfter && reflect.DeepEqual(a, b) {
+			continue
+		}
+		d, inDefaults := defaults[k]
+
+		if aObj, ok := a.(map[string]any); ok {
+			if bObj, ok := b.(map[string]any); ok {
+				sub, had := raw[k].(map[string]any)
+				if !had {
+					sub = map[string]any{}
+				}
+				dObj, _ := d.(map[string]any)
+				updateMap(sub, bObj, aObj, dObj)
+				if had || len(sub) > 0 {
+					raw[k] = sub
+				}
+				continue
+			}
+		}
+
+		switch {
+		case !inAfter && inDefaults && d != nil:
+			raw[k] = nil
+		case !inAfter:
+			delete(raw, k)
+		case inDefaults && reflect.DeepEqual(a, d), !inDefaults && isZeroJSON(a):
+			delete(raw, k)
+		default:
+			raw[k] = a
+		}
+	}
+}
+
+// isZeroJSON tells if a decoded JSON value is what a missing key decodes to.
+func isZeroJSON(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case bool:
+		return !v
+	case float64:
+		return v == 0
+	case map[string]any:
+		return len(v) == 0
+	case []any:
+		return len(v) == 0
+	}
+	return false
+}
+
+// appConfigMap is an app of an approllup.mha.json as LoadConfigMHA would load
+// it, in the generic form toMap gives.
+func appConfigMap(defaults map[string]any, app map[string]any) (map[string]any, error) {
+	blob, err := json.Marshal(mergeMaps(defaults, app))
+	if err != nil {
+		return nil, err
+	}
+	var config Config
+	if err := json.Unmarshal(blob, &config); err != nil {
+		return nil, err
+	}
+	config.SchemaVersion = 0
+	return toMap(config)
+}
+
+// toMap turns a value into the generic form JSON decodes to, so it can be
+// compared with raw config maps.
+func toMap(v any) (map[string]any, error) {
+	blob, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var m map[string]any
+	if err := json.Unmarshal(blob, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// configMigration upgrades a raw app config to the next schema version. It
+// works on the decoded JSON, as fields it renames no longer exist in Config.
+type configMigration struct {
+	Version int // schema version the config is at afterwards
+	Desc    string
+	Apply   func(config map[string]any) error
+}
+
+// configMigrations holds every migration in order. A change to the config
+// format that old files need upgrading for adds one here.
+var configMigrations = []configMigration{
+	{
+		Version: 1,
+		Desc:    "start recording schema_version, no fields change",
+		Apply:   func(config map[string]any) error { return nil },
+	},
+}
+
+// CONFIG_SCHEMA_VERSION is the version configs are saved at.
+var CONFIG_SCHEMA_VERSION = configMigrations[len(configMigrations)-1].Version
+
+// checkSchemaVersion fails for configs written by a newer hyp, which may use
+// fields this one would silently drop.
+func checkSchemaVersion(version int) error {
+	if version > CONFIG_SCHEMA_VERSION {
+		return fmt.Errorf("schema_version %d is newer than this hyp understands (%d), update hyp", version, CONFIG_SCHEMA_VERSION)
+	}
+	return nil
+}
+
+// migrateConfigMap runs the migrations a raw config at version from needs.
+func migrateConfigMap(config map[string]any, from int) error {
+	for _, m := range configMigrations {
+		if m.Version <= from {
+			continue
+		}
+		if err := m.Apply(config); err != nil {
+			return fmt.Errorf("migrating to schema_version %d: %w", m.Version, err)
+		}
+	}
+	return nil
+}
+
+// schemaVersionOf reads schema_version from a raw config, 0 when it's missing.
+func schemaVersionOf(config map[string]any) (int, error) {
+	raw, ok := config["schema_version"]
+	if !ok || raw == nil {
+		return 0, nil
+	}
+	n, ok := raw.(float64)
+	if !ok || n != float64(int(n)) {
+		return 0, errors.New("schema_version should be a whole number")
+	}
+	return int(n), nil
+}
+
+// migrateMHAFile brings the defaults and every app of a multi-hyp file up to
+// the current schema version.
+func migrateMHAFile(file *mhaFile) error {
+	if err := checkSchemaVersion(file.SchemaVersion); err != nil {
+		return err
+	}
+	file.loadedVersion = file.SchemaVersion
+	if file.SchemaVersion == CONFIG_SCHEMA_VERSION {
+		return nil
+	}
+
+	if file.Defaults != nil {
+		if err := migrateConfigMap(file.Defaults, file.SchemaVersion); err != nil {
+			return fmt.Errorf("defaults: %w", err)
+		}
+	}
+	for i, app := range file.Apps {
+		if err := migrateConfigMap(app, file.SchemaVersion); err != nil {
+			return fmt.Errorf("app %d: %w", i, err)
+		}
+	}
+
+	file.SchemaVersion = CONFIG_SCHEMA_VERSION
+	return nil
+}
+
+// backupOldConfig copies a config file that was loaded at an older schema
+// version to path.v<from>.bak, before it's saved at the current one. Nothing
+// older is ever overwritten without a copy, whichever command saves it.
+func backupOldConfig(path string, from int) error {
+	if from >= CONFIG_SCHEMA_VERSION {
+		return nil
+	}
+	original, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	backup := fmt.Sprintf("%s.v%d.bak", path, from)
+	if err := os.WriteFile(backup, original, 0666); err != nil {
+		return err
+	}
+	fmt.Printf("Upgraded %s from schema_version %d to %d, the old file is in %s\n", path, from, CONFIG_SCHEMA_VERSION, backup)
+	return nil
+}
+
+// ==================== COMMAND ====================
+
+func runConfigMigrate(args []string) error {
+	fs := flag.NewFlagSet("config migrate", flag.ExitOnError)
+	projectPath := projectFlag(fs)
+	fs.Parse(args)
+
+	project, err := openProject(*projectPath)
+	if err != nil {
+		return err
+	}
+	path := project.ConfigPath
+
+	blob, err := readConfigFile(path)
+	if err != nil {
+		return configError(path, err)
+	}
+
+	var from int
+	var file *mhaFile
+	if project.MHA {
+		file, err = parseMHAFile(blob)
+		if err != nil {
+			return configError(path, decodeError(path, blob, err))
+		}
+		from = file.SchemaVersion
+	} else {
+		var raw map[string]any
+		if err := json.Unmarshal(blob, &raw); err != nil {
+			return configError(path, decodeError(path, blob, err))
+		}
+		if from, err = schemaVersionOf(raw); err != nil {
+			return configError(path, err)
+		}
+	}
+
+	if err := checkSchemaVersion(from); err != nil {
+		return configError(path, err)
+	}
+	if from == CONFIG_SCHEMA_VERSION {
+		fmt.Printf("%s is already at schema_version %d\n", path, from)
+		return nil
+	}
+
+	for _, m := range configMigrations {
+		if m.Version > from {
+			fmt.Printf("  %d: %s\n", m.Version, m.Desc)
+		}
+	}
+
+	// Saving backs the old file up and stamps the current version
+	if project.MHA {
+		if err := migrateMHAFile(file); err != nil {
+			return configError(path, err)
+		}
+		if err := writeMHAFile(path, file); err != nil {
+			return configError(path, err)
+		}
+		return nil
+	}
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		return err
+	}
+	return SaveConfig(path, config)
+}
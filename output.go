@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const DEFAULT_OUT_NAME = "{name}.hyp"
+
+// templateToken is a {token} in out_name or a define.
+var templateToken = regexp.MustCompile(`\{(\w+)\}`)
+
+// outputPath is where an app's .hyp is written. The -out flag wins over the
+// app's out_dir, and both default to the directory of the project config.
+func outputPath(opts BuildOptions, project *Project, config *Config) (string, error) {
+	dir := project.Dir
+	switch {
+	case opts.OutDir != "":
+		abs, err := filepath.Abs(opts.OutDir)
+		if err != nil {
+			return "", err
+		}
+		dir = abs
+	case config.OutDir != "":
+		dir = filepath.Join(project.Dir, config.OutDir)
+	}
+
+	name, err := outputName(config)
+	if err != nil {
+		return "", configError(project.ConfigPath, err)
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// outputName fills in the out_name template, e.g. "{name}-{app_version}.hyp".
+func outputName(config *Config) (string, error) {
+	template := config.OutName
+	if template == "" {
+		template = DEFAULT_OUT_NAME
+	}
+
+	values := map[string]string{
+		"name":        config.Data.Name,
+		"id":          config.Data.ID,
+		"version":     strconv.Itoa(config.Data.Version),
+		"app_version": config.AppVersion,
+	}
+	if values["name"] == "" {
+		values["name"] = "app"
+	}
+
+	var unknown []string
+	name := templateToken.ReplaceAllStringFunc(template, func(token string) string {
+		key := strings.Trim(token, "{}")
+		value, ok := values[key]
+		if !ok {
+			unknown = append(unknown, token)
+		}
+		return value
+	})
+	if len(unknown) > 0 {
+		return "", fmt.Errorf("out_name %q uses unknown %s, use {name}, {id}, {version} or {app_version}", template, strings.Join(unknown, ", "))
+	}
+
+	name = sanitizeFilename(name)
+	if !strings.HasSuffix(name, ".hyp") {
+		name += ".hyp"
+	}
+	return name, nil
+}
+
+// sanitizeFilename swaps characters that would put a file somewhere else, or
+// that some systems reject, for dashes.
+func sanitizeFilename(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < ' ' || r == ' ' || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '-'
+		}
+		return r
+	}, strings.TrimSpace(name))
+
+	// "." and ".." would still point at a directory
+	if strings.Trim(name, ".") == "" {
+		return "app"
+	}
+	return name
+}
+
+// buildFiles are the files written for the build at hypPath: the .hyp, its
+// -bjson dump and its reports.
+func buildFiles(hypPath string) []string {
+	report := reportPath(hypPath)
+	return []string{hypPath, hypPath + ".json", report + ".json", report + ".html"}
+}
+
+// keepPreviousBuilds moves the build at path out of the way before it's
+// overwritten: name.hyp becomes name.1.hyp, name.1.hyp becomes name.2.hyp and
+// so on, keeping at most keep of them. The files written next to each build
+// move with it. Nothing moves if the new build is the same.
+func keepPreviousBuilds(path string, data []byte, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+
+	current, err := os.ReadFile(path)
+	if err != nil || bytes.Equal(current, data) {
+		return nil
+	}
+
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	previous := func(n int) string {
+		return fmt.Sprintf("%s.%d%s", base, n, ext)
+	}
+
+	// Renames files of one build to those of another, skipping missing ones
+	move := func(from string, to string) error {
+		for i, f := range buildFiles(from) {
+			if err := os.Rename(f, buildFiles(to)[i]); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, f := range buildFiles(previous(keep)) {
+		os.Remove(f)
+	}
+	for n := keep - 1; n >= 1; n-- {
+		if err := move(previous(n), previous(n+1)); err != nil {
+			return err
+		}
+	}
+	return move(path, previous(1))
+}
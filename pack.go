@@ -0,0 +1,169 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+const HYPPACK_EXT = ".hyppack"
+const HYPPACK_INDEX = "index.json"
+
+// PackIndex lists the apps in a .hyppack, a zip of .hyp files that ships a
+// whole multi-hyp project as one file.
+type PackIndex struct {
+	Apps []PackEntry `json:"apps"`
+}
+
+type PackEntry struct {
+	Name       string `json:"name"`
+	ID         string `json:"id"`
+	Version    int    `json:"version"`
+	AppVersion string `json:"app_version"`
+	File       string `json:"file"` // the .hyp inside the pack
+	Size       int    `json:"size"`
+	SHA256     string `json:"sha256"`
+}
+
+// writePack zips built apps into a .hyppack with an index in front. Apps are
+// stored by file name, so two builds with the same name can't be packed.
+func writePack(path string, results []*buildResult) error {
+	var index PackIndex
+	files := map[string]string{}
+	for _, r := range results {
+		file := filepath.Base(r.Filename)
+		if other, ok := files[file]; ok {
+			return fmt.Errorf("%s and %s are both built as %s, give them different out_name to pack them", other, r.Header.Blueprint.Name, file)
+		}
+		files[file] = r.Header.Blueprint.Name
+
+		index.Apps = append(index.Apps, PackEntry{
+			Name:       r.Header.Blueprint.Name,
+			ID:         r.Header.Blueprint.ID,
+			Version:    r.Header.Blueprint.Version,
+			AppVersion: r.Config.AppVersion,
+			File:       file,
+			Size:       len(r.Data),
+			SHA256:     hashBytes(r.Data),
+		})
+	}
+
+	indexData, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	// No timestamps, so packing the same builds gives the same file
+	add := func(name string, data []byte) error {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+
+	if err := add(HYPPACK_INDEX, indexData); err != nil {
+		return err
+	}
+	for i, r := range results {
+		if err := add(index.Apps[i].File, r.Data); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(path, buf.Bytes(), 0666); err != nil {
+		return err
+	}
+	fmt.Printf("Packed %d apps into %s (%s)\n", len(results), path, formatBytes(buf.Len()))
+	return nil
+}
+
+// readPack opens a .hyppack and checks every app in it against the index.
+func readPack(path string) (*PackIndex, map[string][]byte, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, nil, assetError(path, err)
+	}
+	defer zr.Close()
+
+	files := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			return nil, nil, assetError(path, err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, nil, assetError(path, fmt.Errorf("%s: %w", f.Name, err))
+		}
+		files[f.Name] = data
+	}
+
+	indexData, ok := files[HYPPACK_INDEX]
+	if !ok {
+		return nil, nil, assetError(path, errors.New("not a .hyppack, "+HYPPACK_INDEX+" is missing"))
+	}
+
+	var index PackIndex
+	if err := json.Unmarshal(indexData, &index); err != nil {
+		return nil, nil, assetError(path, fmt.Errorf("%s: %w", HYPPACK_INDEX, err))
+	}
+
+	var errs []error
+	for _, app := range index.Apps {
+		data, ok := files[app.File]
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Errorf("%s is in the index but not the pack", app.File))
+		case hashBytes(data) != app.SHA256:
+			errs = append(errs, fmt.Errorf("%s doesn't match its sha256 in the index", app.File))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, nil, assetError(path, errors.Join(errs...))
+	}
+
+	return &index, files, nil
+}
+
+// unpackPack pulls the .hyp files out of a .hyppack into a directory named
+// after it.
+func unpackPack(filename string) error {
+	index, files, err := readPack(filename)
+	if err != nil {
+		return err
+	}
+
+	dir := strings.TrimSuffix(filepath.Base(filename), HYPPACK_EXT)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "APP\tID\tVERSION\tSIZE\tFILE")
+	for _, app := range index.Apps {
+		out := filepath.Join(dir, filepath.Base(app.File))
+		if err := os.WriteFile(out, files[app.File], 0666); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", app.Name, app.ID, app.AppVersion, formatBytes(app.Size), out)
+	}
+	w.Flush()
+
+	return os.WriteFile(filepath.Join(dir, HYPPACK_INDEX), files[HYPPACK_INDEX], 0666)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// DEFAULT_BUILD_COMMAND bundles the app's script when the profile doesn't say otherwise.
+var DEFAULT_BUILD_COMMAND = []string{"npx", "rollup", "-c"}
+
+// Profile overrides parts of an app for one place it's built for, such as a
+// staging world, and is picked with -profile.
+type Profile struct {
+	Data         map[string]any    `json:"data,omitempty"`          // fields of data to override, e.g. name or public
+	Props        map[string]any    `json:"props,omitempty"`         // initial values by prop key
+	BuildCommand []string          `json:"build_command,omitempty"` // run instead of npx rollup -c
+	Env          map[string]string `json:"env,omitempty"`           // added to the build command's environment
+	Defines      map[string]string `json:"defines,omitempty"`       // laid over the app's defines
+}
+
+// profileNames lists the profiles of an app, sorted.
+func (c *Config) profileNames() []string {
+	return sortedKeys(c.Profiles)
+}
+
+// applyProfile overrides the metadata and defines of an app with the named
+// profile. The rest of the profile is used while building, see buildCommand
+// and profileProps. Paths in the overrides are resolved like the app's own, so
+// the config has to be rebased first.
+func applyProfile(config *Config, name string) error {
+	if name == "" {
+		return nil
+	}
+
+	profile, ok := config.Profiles[name]
+	if !ok || profile == nil {
+		if len(config.Profiles) == 0 {
+			return fmt.Errorf("no profile %q, %s has no profiles", name, config.Data.Name)
+		}
+		return fmt.Errorf("no profile %q, %s has %s", name, config.Data.Name, strings.Join(config.profileNames(), ", "))
+	}
+
+	if len(profile.Defines) > 0 {
+		defines := make(map[string]string, len(config.Defines)+len(profile.Defines))
+		for k, v := range config.Defines {
+			defines[k] = v
+		}
+		for k, v := range profile.Defines {
+			defines[k] = v
+		}
+		config.Defines = defines
+	}
+	if len(profile.Data) == 0 {
+		return nil
+	}
+
+	base, err := toMap(config.Data)
+	if err != nil {
+		return err
+	}
+	blob, err := json.Marshal(mergeMaps(base, profile.Data))
+	if err != nil {
+		return err
+	}
+
+	var data MetaData
+	dec := json.NewDecoder(bytes.NewReader(blob))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&data); err != nil {
+		return fmt.Errorf("profile %s: data: %w", name, err)
+	}
+
+	if _, ok := profile.Data["model"]; ok {
+		data.Model = config.resolvePath(data.Model)
+	}
+	if _, ok := profile.Data["image"]; ok && data.Image != "" {
+		data.Image = config.resolvePath(data.Image)
+	}
+	config.Data = data
+	return nil
+}
+
+// buildCommand is the command that bundles the app's script under a profile.
+// HYP_PROFILE tells rollup configs which profile is being built.
+func buildCommand(config *Config, name string) ([]string, []string) {
+	command := DEFAULT_BUILD_COMMAND
+	env := os.Environ()
+
+	profile := config.Profiles[name]
+	if profile == nil {
+		return command, env
+	}
+	if len(profile.BuildCommand) > 0 {
+		command = profile.BuildCommand
+	}
+
+	env = append(env, "HYP_PROFILE="+name)
+	for _, k := range sortedKeys(profile.Env) {
+		env = append(env, k+"="+profile.Env[k])
+	}
+	return command, env
+}
+
+// profileProps sets the initial values a profile gives props. Keys that name
+// no prop are an error, they're most likely typos.
+func profileProps(config *Config, name string, props []map[string]any) error {
+	profile := config.Profiles[name]
+	if profile == nil || len(profile.Props) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(props))
+	for _, prop := range props {
+		keys = append(keys, prop["key"].(string))
+	}
+
+	for key, value := range profile.Props {
+		i := slices.Index(keys, key)
+		if i < 0 {
+			return fmt.Errorf("profile %s sets prop %q, which isn't in %s", name, key, config.PropsPath)
+		}
+		props[i]["initial"] = value
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Project is an app-rollup project found on disk, either a single app or a
+// multi-hyp project holding several.
+type Project struct {
+	Dir        string // directory holding the config, app paths are relative to it
+	ConfigPath string
+	MHA        bool
+}
+
+// projectFlag adds -project, which every command working on a project takes,
+// to its flags. Pass the result to openProject.
+func projectFlag(fs *flag.FlagSet) *string {
+	return fs.String("project", "", "Project config or directory (found from the working directory by default)")
+}
+
+// openProject finds the project a command works on. An explicit path can be a
+// config file or a directory, otherwise the search starts in the working
+// directory. Either way parent directories are searched like git does.
+func openProject(path string) (*Project, error) {
+	if path == "" {
+		dir, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		return findProject(dir)
+	}
+
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, configError(path, err)
+	}
+	if info.IsDir() {
+		return findProject(path)
+	}
+
+	return &Project{
+		Dir:        filepath.Dir(path),
+		ConfigPath: path,
+		MHA:        isMHAConfig(path),
+	}, nil
+}
+
+// findProject walks up from dir to the first directory holding a project
+// config, in any of the config formats.
+func findProject(dir string) (*Project, error) {
+	for start := dir; ; {
+		var found []string
+		for _, name := range []string{APPROLLUP_FILENAME, APPROLLUP_MHA_NAME} {
+			name = strings.TrimSuffix(name, ".json")
+			for _, ext := range CONFIG_EXTENSIONS {
+				if _, err := os.Stat(filepath.Join(dir, name+ext)); err == nil {
+					found = append(found, name+ext)
+				}
+			}
+		}
+
+		switch {
+		case len(found) > 1:
+			return nil, configError(dir, fmt.Errorf("found %s here, remove all but one or pick one with -project", strings.Join(found, " and ")))
+		case len(found) == 1:
+			path := filepath.Join(dir, found[0])
+			return &Project{Dir: dir, ConfigPath: path, MHA: isMHAConfig(path)}, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, configError(start, fmt.Errorf("no %s or %s (or .yaml, .toml) found here or in any parent directory", APPROLLUP_FILENAME, APPROLLUP_MHA_NAME))
+		}
+		dir = parent
+	}
+}
+
+// AppDir is the directory of an app, MHA sub-apps live in a folder named after them.
+func (p *Project) AppDir(config *Config) string {
+	if p.MHA {
+		return filepath.Join(p.Dir, config.Data.Name)
+	}
+	return p.Dir
+}
@@ -0,0 +1,563 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ==================== JS LITERALS ====================
+
+// jsReader reads the plain data literals handed to app.configure. Anything that
+// can't be evaluated without running the script (functions, variables, spreads)
+// is skipped.
+type jsReader struct {
+	src string
+	pos int
+}
+
+func (r *jsReader) peek() byte {
+	if r.pos >= len(r.src) {
+		return 0
+	}
+	return r.src[r.pos]
+}
+
+func (r *jsReader) skipSpace() {
+	for r.pos < len(r.src) {
+		rest := r.src[r.pos:]
+		switch {
+		case rest[0] == ' ' || rest[0] == '\t' || rest[0] == '\n' || rest[0] == '\r':
+			r.pos++
+		case strings.HasPrefix(rest, "//"):
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				r.pos = len(r.src)
+				return
+			}
+			r.pos += end + 1
+		case strings.HasPrefix(rest, "/*"):
+			end := strings.Index(rest[2:], "*/")
+			if end < 0 {
+				r.pos = len(r.src)
+				return
+			}
+			r.pos += end + 4
+		default:
+			return
+		}
+	}
+}
+
+// skipExpression moves past an expression up to the next `,` or closing bracket
+// that isn't nested inside it.
+func (r *jsReader) skipExpression() error {
+	depth := 0
+	for r.pos < len(r.src) {
+		r.skipSpace()
+		switch c := r.peek(); c {
+		case 0:
+			return errors.New("unexpected end of script")
+		case '"', '\'', '`':
+			if _, _, err := r.readString(); err != nil {
+				return err
+			}
+			continue
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			if depth == 0 {
+				return nil
+			}
+			depth--
+		case ',':
+			if depth == 0 {
+				return nil
+			}
+		}
+		r.pos++
+	}
+	return errors.New("unexpected end of script")
+}
+
+// readString reads a quoted string. Template literals with substitutions are
+// consumed but reported as not literal.
+func (r *jsReader) readString() (string, bool, error) {
+	quote := r.src[r.pos]
+	r.pos++
+
+	var sb strings.Builder
+	literal := true
+	for r.pos < len(r.src) {
+		c := r.src[r.pos]
+		switch {
+		case c == quote:
+			r.pos++
+			return sb.String(), literal, nil
+		case c == '\\' && r.pos+1 < len(r.src):
+			r.pos++
+			switch e := r.src[r.pos]; e {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case 'r':
+				sb.WriteByte('\r')
+			case 'u':
+				if r.pos+4 < len(r.src) {
+					if n, err := strconv.ParseUint(r.src[r.pos+1:r.pos+5], 16, 32); err == nil {
+						sb.WriteRune(rune(n))
+						r.pos += 4
+						break
+					}
+				}
+				sb.WriteByte(e)
+			case '\n':
+				// line continuation
+			default:
+				sb.WriteByte(e)
+			}
+			r.pos++
+		case quote == '`' && c == '$' && r.pos+1 < len(r.src) && r.src[r.pos+1] == '{':
+			literal = false
+			r.pos += 2
+			if err := r.skipExpression(); err != nil {
+				return "", false, err
+			}
+			r.pos++ // closing brace
+		case c == '\n' && quote != '`':
+			return "", false, fmt.Errorf("unterminated string at offset %d", r.pos)
+		default:
+			sb.WriteByte(c)
+			r.pos++
+		}
+	}
+	return "", false, errors.New("unterminated string")
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func (r *jsReader) readIdent() string {
+	start := r.pos
+	for r.pos < len(r.src) && isIdentByte(r.src[r.pos]) {
+		r.pos++
+	}
+	return r.src[start:r.pos]
+}
+
+// readValue reads one value. ok is false when the value is an expression that
+// can't be evaluated statically, in which case it has been skipped.
+func (r *jsReader) readValue() (value any, ok bool, err error) {
+	r.skipSpace()
+	start := r.pos
+
+	switch c := r.peek(); {
+	case c == 0:
+		return nil, false, errors.New("unexpected end of script")
+	case c == '[':
+		value, ok, err = r.readArray()
+	case c == '{':
+		value, ok, err = r.readObject()
+	case c == '"' || c == '\'' || c == '`':
+		value, ok, err = r.readString()
+	case c == '-' || c == '+' || c == '.' || c >= '0' && c <= '9':
+		r.pos++
+		for r.pos < len(r.src) && (isIdentByte(r.src[r.pos]) || r.src[r.pos] == '.') {
+			r.pos++
+		}
+		num, perr := strconv.ParseFloat(strings.ReplaceAll(r.src[start:r.pos], "_", ""), 64)
+		value, ok = num, perr == nil
+	case isIdentByte(c):
+		switch r.readIdent() {
+		case "true":
+			value, ok = true, true
+		case "false":
+			value, ok = false, true
+		case "null", "undefined":
+			value, ok = nil, true
+		}
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Whatever follows a literal (operators, calls, arrows) makes it an expression.
+	r.skipSpace()
+	switch r.peek() {
+	case ',', ']', '}', ')':
+		if ok {
+			return value, true, nil
+		}
+	}
+
+	r.pos = start
+	return nil, false, r.skipExpression()
+}
+
+func (r *jsReader) readArray() (any, bool, error) {
+	r.pos++ // [
+	result := []any{}
+
+	for {
+		r.skipSpace()
+		if r.peek() == ']' {
+			r.pos++
+			return result, true, nil
+		}
+
+		if strings.HasPrefix(r.src[r.pos:], "...") {
+			if err := r.skipExpression(); err != nil {
+				return nil, false, err
+			}
+		} else {
+			value, ok, err := r.readValue()
+			if err != nil {
+				return nil, false, err
+			}
+			if ok {
+				result = append(result, value)
+			}
+		}
+
+		r.skipSpace()
+		switch r.peek() {
+		case ',':
+			r.pos++
+		case ']':
+		default:
+			return nil, false, fmt.Errorf("unexpected %q in array at offset %d", r.peek(), r.pos)
+		}
+	}
+}
+
+func (r *jsReader) readObject() (any, bool, error) {
+	r.pos++ // {
+	result := map[string]any{}
+
+	for {
+		r.skipSpace()
+		if r.peek() == '}' {
+			r.pos++
+			return result, true, nil
+		}
+
+		var key string
+		switch c := r.peek(); {
+		case c == '"' || c == '\'':
+			k, _, err := r.readString()
+			if err != nil {
+				return nil, false, err
+			}
+			key = k
+		case isIdentByte(c):
+			key = r.readIdent()
+		}
+
+		r.skipSpace()
+		if key != "" && r.peek() == ':' {
+			r.pos++
+			value, ok, err := r.readValue()
+			if err != nil {
+				return nil, false, err
+			}
+			if ok {
+				result[key] = value
+			}
+		} else if err := r.skipExpression(); err != nil {
+			// spreads, computed keys, shorthands and methods
+			return nil, false, err
+		}
+
+		r.skipSpace()
+		switch r.peek() {
+		case ',':
+			r.pos++
+		case '}':
+		default:
+			return nil, false, fmt.Errorf("unexpected %q in object at offset %d", r.peek(), r.pos)
+		}
+	}
+}
+
+// ==================== EXTRACTION ====================
+
+var configureCall = regexp.MustCompile(`\bapp\s*\.\s*configure\s*\(\s*(?:\(\s*\)\s*=>\s*)?`)
+
+// @prop {type} key attr=value attr="quoted value"
+var propAnnotation = regexp.MustCompile(`@prop\s+\{(\w+)\}\s+([\w$]+)([^\n]*)`)
+var propAttribute = regexp.MustCompile(`([\w$]+)=("(?:[^"\\]|\\.)*"|'(?:[^'\\]|\\.)*'|[^\s*]+)`)
+
+// extractProps collects the props declared in a script, from `app.configure`
+// arrays first and then from `@prop` annotations in comments.
+func extractProps(src string) (Props, error) {
+	var props Props
+	byKey := map[string]Prop{}
+
+	add := func(prop Prop) {
+		key, _ := prop["key"].(string)
+		if key == "" {
+			return
+		}
+		if existing, exists := byKey[key]; exists {
+			for field, value := range prop {
+				if _, set := existing[field]; !set {
+					existing[field] = value
+				}
+			}
+			return
+		}
+		byKey[key] = prop
+		props = append(props, prop)
+	}
+
+	for _, loc := range configureCall.FindAllStringIndex(src, -1) {
+		r := &jsReader{src: src, pos: loc[1]}
+		if r.peek() != '[' {
+			continue
+		}
+
+		value, _, err := r.readValue()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read app.configure at offset %d: %w", loc[0], err)
+		}
+
+		fields, _ := value.([]any)
+		for _, field := range fields {
+			if obj, ok := field.(map[string]any); ok {
+				add(obj)
+			}
+		}
+	}
+
+	for _, match := range propAnnotation.FindAllStringSubmatch(src, -1) {
+		prop := Prop{"type": match[1], "key": match[2]}
+		for _, attr := range propAttribute.FindAllStringSubmatch(match[3], -1) {
+			prop[attr[1]] = annotationValue(attr[2])
+		}
+		add(prop)
+	}
+
+	return props, nil
+}
+
+func annotationValue(raw string) any {
+	if raw[0] == '"' || raw[0] == '\'' {
+		r := &jsReader{src: raw}
+		if s, _, err := r.readString(); err == nil {
+			return s
+		}
+		return raw
+	}
+
+	switch raw {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+
+	if num, err := strconv.ParseFloat(raw, 64); err == nil {
+		return num
+	}
+	return raw
+}
+
+// mergeProps lays the script's props over props.json. Fields only kept in
+// props.json (like local file paths for "initial") survive. Props the script
+// doesn't declare are kept after the rest, and their keys returned, unless
+// prune is set. The extractor can miss props built at runtime.
+func mergeProps(script Props, file Props, prune bool) (Props, []string) {
+	existing := map[string]Prop{}
+	inScript := map[string]bool{}
+	for _, prop := range file {
+		if key, ok := prop["key"].(string); ok {
+			existing[key] = prop
+		}
+	}
+
+	merged := make(Props, 0, len(script))
+	for _, prop := range script {
+		key := prop["key"].(string)
+		inScript[key] = true
+
+		result := Prop{}
+		for field, value := range existing[key] {
+			result[field] = value
+		}
+		for field, value := range prop {
+			result[field] = value
+		}
+		merged = append(merged, result)
+	}
+
+	var undeclared []string
+	for _, prop := range file {
+		key, _ := prop["key"].(string)
+		if inScript[key] {
+			continue
+		}
+		undeclared = append(undeclared, key)
+		if !prune {
+			merged = append(merged, prop)
+		}
+	}
+	return merged, undeclared
+}
+
+// diffProps describes every difference between the script's props and props.json.
+func diffProps(script Props, file Props) []string {
+	var drift []string
+
+	inScript := map[string]bool{}
+	existing := map[string]Prop{}
+	for _, prop := range file {
+		if key, ok := prop["key"].(string); ok {
+			existing[key] = prop
+		}
+	}
+
+	for _, prop := range script {
+		key := prop["key"].(string)
+		inScript[key] = true
+
+		current, exists := existing[key]
+		if !exists {
+			drift = append(drift, fmt.Sprintf("%s: missing from props.json", key))
+			continue
+		}
+
+		fields := make([]string, 0, len(prop))
+		for field := range prop {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+
+		for _, field := range fields {
+			if !reflect.DeepEqual(prop[field], current[field]) {
+				drift = append(drift, fmt.Sprintf("%s.%s: script has %s, props.json has %s",
+					key, field, jsonString(prop[field]), jsonString(current[field])))
+			}
+		}
+	}
+
+	for _, prop := range file {
+		if key, ok := prop["key"].(string); ok && !inScript[key] {
+			drift = append(drift, fmt.Sprintf("%s: not declared in the script", key))
+		}
+	}
+
+	return drift
+}
+
+func jsonString(value any) string {
+	if value == nil {
+		return "nothing"
+	}
+	blob, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(blob)
+}
+
+func saveProps(path string, props Props) error {
+	jsonData, err := json.MarshalIndent(props, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+	return os.WriteFile(path, jsonData, 0666)
+}
+
+// ==================== COMMAND ====================
+
+func runPropsCommand(args []string) error {
+	if len(args) < 1 || args[0] != "extract" {
+		return fmt.Errorf("usage: hyp props extract [-check] [-prune] [-src file] [-app name] [-project path]")
+	}
+
+	fs := flag.NewFlagSet("props extract", flag.ExitOnError)
+	check := fs.Bool("check", false, "Only report drift between the script and props.json")
+	prune := fs.Bool("prune", false, "Drop props the script doesn't declare instead of keeping them")
+	srcPath := fs.String("src", "", "Script source to read props from (defaults to script_path)")
+	appName := fs.String("app", "", "App to use in a multi-hyp project")
+	projectPath := projectFlag(fs)
+	fs.Parse(args[1:])
+
+	project, err := openProject(*projectPath)
+	if err != nil {
+		return err
+	}
+
+	config, err := loadAppConfig(project, *appName)
+	if err != nil {
+		return err
+	}
+
+	if *srcPath == "" {
+		*srcPath = config.ScriptPath
+	}
+
+	src, err := os.ReadFile(*srcPath)
+	if err != nil {
+		return &BuildError{Kind: ErrScript, Path: *srcPath, Err: err}
+	}
+
+	scriptProps, err := extractProps(string(src))
+	if err != nil {
+		return &BuildError{Kind: ErrScript, Path: *srcPath, Err: err}
+	}
+	fmt.Printf("Found %d props in %s\n", len(scriptProps), *srcPath)
+
+	var fileProps Props
+	if _, err := os.Stat(config.PropsPath); err == nil {
+		fileProps, err = loadProps(config.PropsPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	if *check {
+		drift := diffProps(scriptProps, fileProps)
+		if len(drift) == 0 {
+			fmt.Printf("%s is in sync with %s\n", config.PropsPath, *srcPath)
+			return nil
+		}
+
+		for _, line := range drift {
+			fmt.Println("  " + line)
+		}
+		return configError(config.PropsPath, fmt.Errorf("drifted from %s (%d differences)", *srcPath, len(drift)))
+	}
+
+	for _, line := range diffProps(scriptProps, fileProps) {
+		fmt.Println("  " + line)
+	}
+
+	merged, undeclared := mergeProps(scriptProps, fileProps, *prune)
+	if err := saveProps(config.PropsPath, merged); err != nil {
+		return configError(config.PropsPath, err)
+	}
+	if len(undeclared) > 0 {
+		if *prune {
+			fmt.Printf("Dropped %s, not declared in the script\n", strings.Join(undeclared, ", "))
+		} else {
+			fmt.Printf("Kept %s, not declared in the script (use -prune to drop them)\n", strings.Join(undeclared, ", "))
+		}
+	}
+	fmt.Printf("Wrote %s\n", config.PropsPath)
+	return nil
+}
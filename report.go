@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"os/exec"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BuildReport is written next to every .hyp as name.report.json, so a build
+// can be reviewed or compared without scrolling through its log.
+type BuildReport struct {
+	App        string            `json:"app"`
+	ID         string            `json:"id"`
+	AppVersion string            `json:"app_version,omitempty"`
+	Profile    string            `json:"profile,omitempty"`
+	Started    time.Time         `json:"started"`
+	Inputs     ReportInputs      `json:"inputs"`
+	Defines    map[string]string `json:"defines,omitempty"`
+	Assets     []ReportAsset     `json:"assets"`
+	Phases     []ReportPhase     `json:"phases"`
+	Warnings   []string          `json:"warnings"`
+	Tools      map[string]string `json:"tools"`
+	Output     string            `json:"output"`
+	Size       int               `json:"size"`
+	SHA256     string            `json:"sha256"`
+}
+
+// ReportInputs are the files an app was built from, as resolved for the build.
+type ReportInputs struct {
+	Config    string `json:"config"`
+	Dir       string `json:"dir"`
+	Script    string `json:"script"`
+	Model     string `json:"model"`
+	Image     string `json:"image,omitempty"`
+	Props     string `json:"props"`
+	Assets    string `json:"assets"`
+	BuildInfo string `json:"build_info,omitempty"`
+}
+
+type ReportAsset struct {
+	URL    string `json:"url"`
+	Type   string `json:"type"`
+	Mime   string `json:"mime"`
+	Size   int    `json:"size"`
+	Source string `json:"source"`
+	SHA256 string `json:"sha256"`
+}
+
+type ReportPhase struct {
+	Name       string  `json:"name"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+func newBuildReport(opts BuildOptions, config *Config) *BuildReport {
+	report := &BuildReport{
+		App:        config.Data.Name,
+		ID:         config.Data.ID,
+		AppVersion: config.AppVersion,
+		Profile:    opts.Profile,
+		Started:    time.Now().UTC(),
+		Inputs: ReportInputs{
+			Dir:    config.Dir,
+			Script: config.ScriptPath,
+			Model:  config.Data.Model,
+			Image:  config.Data.Image,
+			Props:  config.PropsPath,
+			Assets: config.AssetsPath,
+		},
+		Defines:  config.Defines,
+		Warnings: []string{},
+		Tools:    toolVersions(opts, config),
+	}
+	if config.BuildInfo != "" {
+		report.Inputs.BuildInfo = config.resolvePath(config.BuildInfo)
+	}
+	return report
+}
+
+// phase runs one step of a build, timing it for the report.
+func (r *BuildReport) phase(name string, run func() error) error {
+	start := time.Now()
+	err := run()
+	r.Phases = append(r.Phases, ReportPhase{Name: name, DurationMS: float64(time.Since(start).Microseconds()) / 1000})
+	return err
+}
+
+// addAssets records the assets that ended up in the .hyp.
+func (r *BuildReport) addAssets(assets []Asset) {
+	for _, a := range assets {
+		r.Assets = append(r.Assets, ReportAsset{
+			URL:    a.URL,
+			Type:   a.Type,
+			Mime:   a.Mime,
+			Size:   len(a.FileData),
+			Source: a.Source,
+			SHA256: hashBytes(a.FileData),
+		})
+	}
+}
+
+// toolVersions lists what took part in a build. Node is only asked when the
+// script is built.
+func toolVersions(opts BuildOptions, config *Config) map[string]string {
+	tools := map[string]string{"go": runtime.Version(), "hyp": "devel"}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		tools["hyp"] = info.Main.Version
+	}
+
+	if !opts.NoScriptBuild {
+		command, _ := buildCommand(config, opts.Profile)
+		tools["build_command"] = strings.Join(command, " ")
+		if version, err := exec.Command("node", "--version").Output(); err == nil {
+			tools["node"] = strings.TrimSpace(string(version))
+		}
+	}
+	return tools
+}
+
+// buildWarnings collects what a build warned about. Props are built on
+// several workers, so it's locked.
+type buildWarnings struct {
+	mu   sync.Mutex
+	list []string
+}
+
+// warn logs a warning and keeps it for the build report.
+func (opts BuildOptions) warn(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	fmt.Fprintln(opts.logger(), msg)
+
+	if opts.Warnings != nil {
+		opts.Warnings.mu.Lock()
+		opts.Warnings.list = append(opts.Warnings.list, msg)
+		opts.Warnings.mu.Unlock()
+	}
+}
+
+// reportPath is where the report of the build at hypPath goes, without the extension.
+func reportPath(hypPath string) string {
+	return strings.TrimSuffix(hypPath, ".hyp") + ".report"
+}
+
+// writeReport saves the report of a written build, and the HTML version of it
+// when asked to.
+func writeReport(opts BuildOptions, result *buildResult) error {
+	report := result.Report
+	report.Output = result.Filename
+	report.Size = len(result.Data)
+	report.SHA256 = hashBytes(result.Data)
+
+	base := reportPath(result.Filename)
+	blob, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(base+".json", blob, 0666); err != nil {
+		return err
+	}
+
+	if !opts.ReportHTML {
+		return nil
+	}
+	f, err := os.Create(base + ".html")
+	if err != nil {
+		return err
+	}
+	if err := reportTemplate.Execute(f, report); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"bytes": formatBytes,
+	"short": func(s string) string { return s[:min(len(s), 12)] },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.App}} build report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+th { background: #f4f4f4; }
+code { font-size: 0.9em; }
+.warning { color: #a60; }
+</style>
+</head>
+<body>
+<h1>{{.App}}{{with .AppVersion}} {{.}}{{end}}{{with .Profile}} ({{.}}){{end}}</h1>
+<p>Built {{.Started.Format "2006-01-02 15:04:05 MST"}} into <code>{{.Output}}</code>, {{bytes .Size}}, sha256 <code>{{.SHA256}}</code></p>
+
+<h2>Warnings</h2>
+{{if .Warnings}}<ul>{{range .Warnings}}<li class="warning">{{.}}</li>{{end}}</ul>{{else}}<p>None</p>{{end}}
+
+<h2>Assets</h2>
+<table>
+<tr><th>Type</th><th>Source</th><th>Size</th><th>Mime</th><th>SHA-256</th></tr>
+{{range .Assets}}<tr><td>{{.Type}}</td><td><code>{{.Source}}</code></td><td>{{bytes .Size}}</td><td>{{.Mime}}</td><td><code title="{{.SHA256}}">{{short .SHA256}}</code></td></tr>
+{{end}}</table>
+
+<h2>Phases</h2>
+<table>
+<tr><th>Phase</th><th>Duration</th></tr>
+{{range .Phases}}<tr><td>{{.Name}}</td><td>{{printf "%.1f" .DurationMS}} ms</td></tr>
+{{end}}</table>
+
+<h2>Inputs</h2>
+<table>
+<tr><td>Config</td><td><code>{{.Inputs.Config}}</code></td></tr>
+<tr><td>Directory</td><td><code>{{.Inputs.Dir}}</code></td></tr>
+<tr><td>Script</td><td><code>{{.Inputs.Script}}</code></td></tr>
+<tr><td>Model</td><td><code>{{.Inputs.Model}}</code></td></tr>
+{{with .Inputs.Image}}<tr><td>Image</td><td><code>{{.}}</code></td></tr>{{end}}
+<tr><td>Props</td><td><code>{{.Inputs.Props}}</code></td></tr>
+<tr><td>Assets</td><td><code>{{.Inputs.Assets}}</code></td></tr>
+{{with .Inputs.BuildInfo}}<tr><td>Build info</td><td><code>{{.}}</code></td></tr>{{end}}
+</table>
+
+{{if .Defines}}<h2>Defines</h2>
+<table>
+{{range $name, $value := .Defines}}<tr><td><code>{{$name}}</code></td><td><code>{{$value}}</code></td></tr>
+{{end}}</table>{{end}}
+
+<h2>Tools</h2>
+<table>
+{{range $name, $version := .Tools}}<tr><td>{{$name}}</td><td><code>{{$version}}</code></td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
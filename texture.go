@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+)
+
+// CACHE_DIR holds what builds keep between runs, next to the project config.
+const CACHE_DIR = ".hypcache"
+const TEXTURE_CACHE_DIR = "textures"
+const DEFAULT_THUMBNAIL_SIZE = 256
+const DEFAULT_JPEG_QUALITY = 85
+
+// textureJob is one run of the pipeline; it doubles as the cache key.
+type textureJob struct {
+	MaxSize int    `json:"max_size"`
+	Format  string `json:"format"`
+	Quality int    `json:"quality"`
+	FlipY   bool   `json:"flip_y"`
+}
+
+func textureJobFor(opts *TextureOptions) textureJob {
+	job := textureJob{Format: opts.Format, Quality: opts.Quality, FlipY: opts.FlipY, MaxSize: opts.MaxSize}
+	if job.Quality == 0 {
+		job.Quality = DEFAULT_JPEG_QUALITY
+	}
+	return job
+}
+
+// errUndecodable is returned for textures asked to change that the standard
+// library can't decode, WebP and KTX2.
+var errUndecodable = errors.New("can't be resized, flipped or converted")
+
+// processTexture runs a texture through the pipeline configured for the app.
+// Results are cached by the hash of the input and the settings used.
+func processTexture(opts BuildOptions, config *Config, source string, data []byte) ([]byte, error) {
+	if config.Textures == nil {
+		return data, nil
+	}
+	return runTextureJob(opts, config, textureJobFor(config.Textures), source, data)
+}
+
+// makeThumbnail shrinks an image down to the blueprint thumbnail.
+func makeThumbnail(opts BuildOptions, config *Config, source string, data []byte) ([]byte, error) {
+	job := textureJob{MaxSize: DEFAULT_THUMBNAIL_SIZE, Format: "png"}
+	if config.Textures != nil && config.Textures.ThumbnailSize > 0 {
+		job.MaxSize = config.Textures.ThumbnailSize
+	}
+	return runTextureJob(opts, config, job, source, data)
+}
+
+// textureCacheDir is where processed textures are kept, in the project's
+// cache rather than wherever hyp was run from.
+func textureCacheDir(config *Config) string {
+	dir := config.CacheDir
+	if dir == "" {
+		dir = filepath.Join(config.Dir, CACHE_DIR)
+	}
+	return filepath.Join(dir, TEXTURE_CACHE_DIR)
+}
+
+// runTextureJob transforms a texture, or takes it from the cache. Textures
+// that can't be decoded are bundled as they are, with a warning.
+func runTextureJob(opts BuildOptions, config *Config, job textureJob, source string, data []byte) ([]byte, error) {
+	settings, err := json.Marshal(job)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheDir := textureCacheDir(config)
+	cachePath := filepath.Join(cacheDir, hashBytes(append(settings, data...)))
+	if cached, err := os.ReadFile(cachePath); err == nil {
+		return cached, nil
+	}
+
+	out, err := transformTexture(job, data)
+	if errors.Is(err, errUndecodable) {
+		opts.warn("Texture %s %v, bundled as is", source, err)
+		return data, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Write then rename, so builds running side by side never read half a file
+	if err := os.MkdirAll(cacheDir, 0777); err == nil {
+		if tmp, err := os.CreateTemp(cacheDir, "tmp-*"); err == nil {
+			_, err = tmp.Write(out)
+			tmp.Close()
+			if err == nil {
+				err = os.Rename(tmp.Name(), cachePath)
+			}
+			if err != nil {
+				os.Remove(tmp.Name())
+			}
+		}
+	}
+	return out, nil
+}
+
+// transformTexture decodes, resizes, flips and re-encodes an image. Images that
+// need none of that are passed through untouched to avoid a lossy round trip.
+func transformTexture(job textureJob, data []byte) ([]byte, error) {
+	format, ok := detectFormat(data)
+	if ok && format != formatPNG && format != formatJPEG {
+		// Their size is unknown without decoding, so any max_size counts
+		if job.MaxSize == 0 && !job.FlipY && (job.Format == "" || job.Format == format.Name) {
+			return data, nil
+		}
+		return nil, fmt.Errorf("is %s, which %w", format.Name, errUndecodable)
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	outFormat := format.Name
+	if job.Format != "" {
+		outFormat = job.Format
+	}
+	if outFormat != "png" && outFormat != "jpeg" {
+		return nil, fmt.Errorf("can't encode textures as %q, use png or jpeg", outFormat)
+	}
+
+	resize := job.MaxSize > 0 && (cfg.Width > job.MaxSize || cfg.Height > job.MaxSize)
+	if !resize && !job.FlipY && outFormat == format.Name {
+		return data, nil
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	img := toRGBA(src)
+	if resize {
+		w, h := fitSize(cfg.Width, cfg.Height, job.MaxSize)
+		img = resizeImage(img, w, h)
+	}
+	if job.FlipY {
+		flipVertical(img)
+	}
+
+	var buf bytes.Buffer
+	switch outFormat {
+	case "png":
+		encoder := png.Encoder{CompressionLevel: png.BestCompression}
+		err = encoder.Encode(&buf, img)
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: job.Quality})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func toRGBA(src image.Image) *image.RGBA {
+	bounds := src.Bounds()
+	img := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(img, img.Bounds(), src, bounds.Min, draw.Src)
+	return img
+}
+
+// fitSize scales w x h down so the longest side is maxSize, keeping the aspect.
+func fitSize(w int, h int, maxSize int) (int, int) {
+	if w >= h {
+		return maxSize, max(1, h*maxSize/w)
+	}
+	return max(1, w*maxSize/h), maxSize
+}
+
+// resizeImage shrinks an image by averaging the source pixels under each
+// destination pixel.
+func resizeImage(src *image.RGBA, w int, h int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+
+	for y := 0; y < h; y++ {
+		y0, y1 := y*sh/h, max((y+1)*sh/h, y*sh/h+1)
+		for x := 0; x < w; x++ {
+			x0, x1 := x*sw/w, max((x+1)*sw/w, x*sw/w+1)
+
+			var r, g, b, a, n int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += int(p[0])
+					g += int(p[1])
+					b += int(p[2])
+					a += int(p[3])
+					n++
+				}
+			}
+
+			d := dst.Pix[y*dst.Stride+x*4:]
+			d[0], d[1], d[2], d[3] = uint8(r/n), uint8(g/n), uint8(b/n), uint8(a/n)
+		}
+	}
+
+	return dst
+}
+
+func flipVertical(img *image.RGBA) {
+	h := img.Bounds().Dy()
+	row := make([]byte, img.Stride)
+	for y := 0; y < h/2; y++ {
+		top := img.Pix[y*img.Stride : (y+1)*img.Stride]
+		bottom := img.Pix[(h-1-y)*img.Stride : (h-y)*img.Stride]
+		copy(row, top)
+		copy(top, bottom)
+		copy(bottom, row)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path"
+	"path/filepath"
 	"strings"
 )
 
@@ -18,30 +20,37 @@ func getFilename(assetUrl string, blueprint Blueprint) string {
 		}
 
 		if a["url"] == assetUrl {
-			return a["name"].(string)
+			name, _ := a["name"].(string)
+			return filepath.Base(name)
 		}
 	}
 	return ""
 }
 
-func unpackHyp(filename string) {
+func unpackHyp(filename string) error {
+	if filepath.Ext(filename) == HYPPACK_EXT {
+		return unpackPack(filename)
+	}
+
 	blob, err := os.ReadFile(filename)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	blueprint, assets, err := ImportApp(blob)
 	if err != nil {
-		panic(err)
+		return assetError(filename, err)
 	}
 
 	fmt.Printf("Total assets %d\n", len(assets))
-	os.Mkdir(blueprint.Name, 0777)
+	if err := os.MkdirAll(blueprint.Name, 0777); err != nil {
+		return err
+	}
 
 	for _, asset := range assets {
 		fmt.Printf("%s - %s - %d\n", asset.URL, asset.Type, asset.Size)
-		filename := strings.Split(asset.URL, "//")[1]
-		ext := strings.Split(asset.URL, ".")[1]
+		filename := strings.TrimPrefix(asset.URL, "asset://")
+		ext := strings.TrimPrefix(path.Ext(asset.URL), ".")
 
 		if asset.Type == "script" {
 			filename = "script.js"
@@ -56,7 +65,9 @@ func unpackHyp(filename string) {
 			}
 		}
 
-		os.WriteFile(fmt.Sprintf("./%s/%s", blueprint.Name, filename), asset.FileData, 0777)
+		if err := os.WriteFile(fmt.Sprintf("./%s/%s", blueprint.Name, filename), asset.FileData, 0777); err != nil {
+			return err
+		}
 	}
 
 	hdr := HypeHeader{
@@ -65,5 +76,8 @@ func unpackHyp(filename string) {
 	}
 
 	json_data, err := json.MarshalIndent(hdr, "", "    ")
-	os.WriteFile(fmt.Sprintf("./%s/header.json", blueprint.Name), json_data, 0777)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fmt.Sprintf("./%s/header.json", blueprint.Name), json_data, 0777)
 }